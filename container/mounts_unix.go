@@ -11,6 +11,16 @@ type Mount struct {
 	Writable    bool   `json:"writable"`
 	Data        string `json:"data"`
 	Propagation string `json:"mountpropagation"`
+
+	// Options carries the structured option map a mount point middleware
+	// may have replaced via Attachment.NewOptions, in place of the
+	// opaque Data string.
+	Options map[string]string `json:"options"`
+
+	// Mode carries the effective mode a mount point middleware may have
+	// replaced via Attachment.NewMode (e.g. "ro", "rw" or "mknod" for a
+	// TypeBlock mount).
+	Mode string `json:"mode"`
 }
 
 func MountOfMountPoint(m *volume.MountPoint) Mount {
@@ -19,5 +29,7 @@ func MountOfMountPoint(m *volume.MountPoint) Mount {
 		Destination: m.Destination,
 		Writable:    m.RW,
 		Propagation: string(m.Propagation),
+		Options:     m.EffectiveOptions(),
+		Mode:        m.EffectiveMode(),
 	}
 }
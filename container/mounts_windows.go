@@ -7,6 +7,14 @@ type Mount struct {
 	Source      string `json:"source"`
 	Destination string `json:"destination"`
 	Writable    bool   `json:"writable"`
+
+	// Options carries the structured option map a mount point middleware
+	// may have replaced via Attachment.NewOptions.
+	Options map[string]string `json:"options"`
+
+	// Mode carries the effective mode a mount point middleware may have
+	// replaced via Attachment.NewMode.
+	Mode string `json:"mode"`
 }
 
 func MountOfMountPoint(m *volume.MountPoint) Mount {
@@ -14,5 +22,7 @@ func MountOfMountPoint(m *volume.MountPoint) Mount {
 		Source:      m.Source,
 		Destination: m.Destination,
 		Writable:    m.RW,
+		Options:     m.EffectiveOptions(),
+		Mode:        m.EffectiveMode(),
 	}
 }
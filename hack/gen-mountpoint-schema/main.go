@@ -0,0 +1,40 @@
+// Command gen-mountpoint-schema regenerates
+// volume/mounts/schema/mountpoint.schema.json from the mountpoint
+// package's current pattern types. Run it after changing
+// MountPointPattern or any type it references, then commit the
+// resulting diff alongside the Go change -- TestSchemaNoDrift fails CI
+// if the two fall out of sync.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/docker/docker/volume/mounts/schema"
+)
+
+func main() {
+	out := flag.String("o", "volume/mounts/schema/mountpoint.schema.json", "output path")
+	flag.Parse()
+
+	doc, err := schema.Generate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gen-mountpoint-schema:", err)
+		os.Exit(1)
+	}
+
+	encoded, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gen-mountpoint-schema:", err)
+		os.Exit(1)
+	}
+	encoded = append(encoded, '\n')
+
+	if err := ioutil.WriteFile(*out, encoded, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "gen-mountpoint-schema:", err)
+		os.Exit(1)
+	}
+}
@@ -41,6 +41,7 @@ type mountPointController struct {
 	propertiesRes mountpoint.PropertiesResponse // propertiesRes holds the plugin response to properties requests
 	attachRes     mountpoint.AttachResponse     // attachRes holds the plugin response to attach requests
 	detachRes     mountpoint.DetachResponse     // detachRes holds the plugin response to detach requests
+	reconcileRes  mountpoint.ReconcileResponse  // reconcileRes holds the plugin response to reconcile requests
 	attachCnt     int                           // attachCnt counts the number of attach requests received
 	attachMounts  [][]*mountpoint.MountPoint    // attachMounts is a stack of mount point sets requested for attachment
 }
@@ -57,6 +58,9 @@ func (s *DockerMountPointSuite) SetUpTest(c *check.C) {
 		detachRes: mountpoint.DetachResponse{
 			Success: true,
 		},
+		reconcileRes: mountpoint.ReconcileResponse{
+			Success: true,
+		},
 		attachCnt:    0,
 		attachMounts: [][]*mountpoint.MountPoint{},
 	}
@@ -238,6 +242,25 @@ func (s *DockerMountPointSuite) setupPlugin(c *check.C, i int) {
 		w.Write(b)
 	})
 
+	mux.HandleFunc("/MountPointPlugin.MountPointReconcile", func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		body, err := ioutil.ReadAll(r.Body)
+		c.Assert(err, check.IsNil)
+		reconcileReq := mountpoint.ReconcileRequest{}
+		err = json.Unmarshal(body, &reconcileReq)
+		c.Assert(err, check.IsNil)
+
+		s.events = append(s.events, fmt.Sprintf("%d:reconcile", i))
+
+		reconcileRes := s.ctrl[i].reconcileRes
+		if !reconcileRes.Success {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		b, err := json.Marshal(reconcileRes)
+		c.Assert(err, check.IsNil)
+		w.Write(b)
+	})
+
 	err := os.MkdirAll("/etc/docker/plugins", 0755)
 	c.Assert(err, checker.IsNil)
 
@@ -772,3 +795,84 @@ func (s *DockerMountPointSuite) TestMountPointPluginDaemonRestart(c *check.C) {
 	// no new plugin events have occurred without explicit plugin loading
 	c.Assert(s.events, checker.DeepEquals, []string{})
 }
+
+// TestMountPointPluginDaemonRestartReconciles starts two plugins that
+// are both already registered (unlike TestMountPointPluginDaemonRestart,
+// which exercises the lazy-registration path), runs a container with a
+// mount both plugins' patterns cover, restarts the daemon with
+// --live-restore, and asserts both plugins received a reconcile call --
+// one entry per plugin -- before the later "docker stop" drives any
+// detach.
+func (s *DockerMountPointSuite) TestMountPointPluginDaemonRestartReconciles(c *check.C) {
+	testRequires(c, DaemonIsLinux)
+
+	s.d.Start(c, "--live-restore",
+		fmt.Sprintf("--mount-point-plugin=%s0", testMountPointPlugin),
+		fmt.Sprintf("--mount-point-plugin=%s1", testMountPointPlugin))
+	s.d.LoadBusybox(c)
+
+	s.ctrl[0].attachRes = mountpoint.AttachResponse{
+		Success:     true,
+		Attachments: []mountpoint.Attachment{{Attach: true}},
+	}
+	s.ctrl[1].attachRes = s.ctrl[0].attachRes
+
+	out, err := s.d.Cmd("run", "-d", "-v", "/:/host", "busybox", "top")
+	c.Assert(err, check.IsNil, check.Commentf("output: %s", out))
+	id := strings.TrimSpace(out)
+
+	s.events = []string{}
+	s.d.Restart(c, "--live-restore",
+		fmt.Sprintf("--mount-point-plugin=%s0", testMountPointPlugin),
+		fmt.Sprintf("--mount-point-plugin=%s1", testMountPointPlugin))
+
+	reconciled := map[string]bool{}
+	for _, event := range s.events {
+		if event == "0:reconcile" || event == "1:reconcile" {
+			reconciled[event] = true
+		}
+		c.Assert(event, check.Not(check.Equals), "0:detach")
+		c.Assert(event, check.Not(check.Equals), "1:detach")
+	}
+	c.Assert(reconciled["0:reconcile"], check.Equals, true)
+	c.Assert(reconciled["1:reconcile"], check.Equals, true)
+
+	out, err = s.d.Cmd("stop", id)
+	c.Assert(err, check.IsNil, check.Commentf("output: %s", out))
+}
+
+// TestMountPointPluginSecretFilter exercises the secret mount type the
+// same way TestMountPointPluginVolumeFilter exercises TypeVolume: a
+// plugin declaring a Patterns entry with Type: &typeSecret must not be
+// interposed on ordinary bind/volume mounts. This daemon snapshot has
+// no CLI or swarm-secret path that materializes a TypeSecret
+// MountPoint (secrets never reach the volume/mountpoint chain through
+// "docker run"), so the positive-match half of the filter -- a real
+// secret mount reaching the plugin's Attach -- is covered at the
+// matching-engine level by TestPatternSecretID and
+// TestMountPointRoundTripsThroughProtoConversion in volume/mountpoint
+// instead of here.
+func (s *DockerMountPointSuite) TestMountPointPluginSecretFilter(c *check.C) {
+	typeSecret := mountpoint.TypeSecret
+	s.ctrl[0].propertiesRes = mountpoint.PropertiesResponse{
+		Success: true,
+		Patterns: []mountpoint.Pattern{
+			{Type: &typeSecret},
+		},
+	}
+
+	s.d.Start(c, fmt.Sprintf("--mount-point-plugin=%s0", testMountPointPlugin))
+	s.d.LoadBusybox(c)
+
+	out, err := s.d.Cmd("run", "-d", "-v", "/:/host", "busybox", "top")
+	c.Assert(err, check.IsNil, check.Commentf(out))
+
+	id := strings.TrimSpace(out)
+
+	out, err = s.d.Cmd("ps")
+	c.Assert(err, check.IsNil)
+	c.Assert(assertContainerList(out, []string{id}), check.Equals, true)
+
+	c.Assert(s.ctrl[0].attachCnt, check.Equals, 0)
+	c.Assert(s.events, checker.DeepEquals, []string{"0:properties"})
+}
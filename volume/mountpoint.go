@@ -16,11 +16,17 @@ type AppliedMountPointMiddleware struct {
 	middleware *mountpoint.Middleware          // middleware stores the middleware object
 	Attachment mountpoint.MountPointAttachment // Attachment contains whatever changes the middleware has made to the mount
 	Clock      int                             // Clock is a positive integer used to ensure mount detachments occur in the correct order
+	Digest     string                          // Digest pins the plugin manifest digest applied at Name, if any, so a later plugin upgrade can't silently change detach behavior
 }
 
 // Middleware will retrieve the Middleware object or create a new one if none is available
 func (p AppliedMountPointMiddleware) Middleware() (*mountpoint.Middleware, error) {
 	if p.middleware == nil {
+		if m, ok := lookupStaticMiddleware(p.Name); ok {
+			p.middleware = &m
+			return p.middleware, nil
+		}
+
 		pname := mountpoint.PluginNameOfMiddlewareName(p.Name)
 		if pname == "" {
 			return nil, fmt.Errorf("non-plugin middleware %s not found", p.Name)
@@ -48,6 +54,35 @@ func (m *MountPoint) EffectiveSource() string {
 	return m.Source
 }
 
+// EffectiveOptions is the option map to use for a mount even after
+// middleware may have replaced the original option map, mirroring
+// EffectiveSource's topmost-first walk of AppliedMiddleware.
+func (m *MountPoint) EffectiveOptions() map[string]string {
+	for i := len(m.AppliedMiddleware) - 1; i >= 0; i-- {
+		appliedMiddleware := m.AppliedMiddleware[i]
+		if appliedMiddleware.Attachment.NewOptions != nil {
+			return appliedMiddleware.Attachment.NewOptions
+		}
+	}
+	if v, ok := m.Volume.(DetailedVolume); ok {
+		return v.Options()
+	}
+	return nil
+}
+
+// EffectiveMode is the mode to use for a mount even after middleware may
+// have replaced the original mode, mirroring EffectiveSource's
+// topmost-first walk of AppliedMiddleware.
+func (m *MountPoint) EffectiveMode() string {
+	for i := len(m.AppliedMiddleware) - 1; i >= 0; i-- {
+		appliedMiddleware := m.AppliedMiddleware[i]
+		if appliedMiddleware.Attachment.NewMode != "" {
+			return appliedMiddleware.Attachment.NewMode
+		}
+	}
+	return m.Mode
+}
+
 // PushMiddleware pushes a new applied middleware onto the mount point's
 // middleware stack
 func (m *MountPoint) PushMiddleware(middleware mountpoint.Middleware, attachment mountpoint.MountPointAttachment, clock int) {
@@ -56,6 +91,7 @@ func (m *MountPoint) PushMiddleware(middleware mountpoint.Middleware, attachment
 		middleware: &middleware,
 		Attachment: attachment,
 		Clock:      clock,
+		Digest:     middleware.Digest(),
 	}
 	m.AppliedMiddleware = append(m.AppliedMiddleware, appliedMiddleware)
 }
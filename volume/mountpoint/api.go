@@ -2,6 +2,7 @@ package mountpoint
 
 import (
 	"os"
+	"time"
 
 	"github.com/docker/docker/api/types/mount"
 )
@@ -17,6 +18,21 @@ const (
 	TypeVolume Type = "volume"
 	// TypeTmpfs is the type for mounting tmpfs
 	TypeTmpfs Type = "tmpfs"
+	// TypeSecret is the type for mounting a single secret into a
+	// container. Source/Destination/EffectiveSource carry no secret
+	// payload for this type -- SecretID is an opaque reference the
+	// daemon never resolves itself; only a mount point middleware that
+	// matches the mount (via AttachRequest) is expected to dereference
+	// it against its own secret store and report back a tmpfs
+	// EffectiveSource in its Attachment. This keeps secret material out
+	// of docker inspect, events and any other diagnostic surface that
+	// serializes a MountPoint, since none of them carry SecretID through
+	// to resolved content.
+	TypeSecret Type = "secret"
+	// TypeNamedPipe is the type for mounting a host named pipe (FIFO) into a container.
+	TypeNamedPipe Type = "npipe"
+	// TypeBlock is the type for mounting a raw host block device into a container.
+	TypeBlock Type = "block"
 )
 
 const (
@@ -29,6 +45,9 @@ const (
 	// MountPointAPIDetach is the url for mount point detachment interposition
 	MountPointAPIDetach = "MountPointPlugin.MountPointDetach"
 
+	// MountPointAPIReconcile is the url for live-restore attachment reconciliation
+	MountPointAPIReconcile = "MountPointPlugin.MountPointReconcile"
+
 	// MountPointAPIImplements is the name of the interface all mount point plugins implement
 	MountPointAPIImplements = "mountpoint"
 )
@@ -46,6 +65,28 @@ type PropertiesResponse struct {
 	// interposition requests
 	Patterns []Pattern
 
+	// PropagatedMount is the path, inside a containerized (v2) mount
+	// point plugin's own rootfs, that the plugin bind-mounts rshared
+	// before returning any Changes.EffectiveSource from MountPointAttach.
+	// A v2 plugin runs in its own mount namespace, so an EffectiveSource
+	// it returns is only meaningful relative to this path; the chain
+	// joins the two to get a path the daemon's host mount namespace can
+	// actually bind-mount into the target container. Empty for
+	// non-containerized middleware, or a plugin that always returns
+	// host-visible paths.
+	PropagatedMount string `json:",omitempty"`
+
+	// AttachTimeout, if nonzero, is this plugin's advertised bound on a
+	// single MountPointAttach RPC attempt. The chain uses it in place of
+	// its own default timeout when no admin-configured
+	// MiddlewarePolicy.AttachTimeout overrides it.
+	AttachTimeout time.Duration `json:",omitempty"`
+
+	// DetachTimeout, if nonzero, is this plugin's advertised bound on a
+	// single MountPointDetach RPC attempt, with the same precedence as
+	// AttachTimeout.
+	DetachTimeout time.Duration `json:",omitempty"`
+
 	// Err stores a message in case there's an error
 	Err string `json:",omitempty"`
 }
@@ -79,6 +120,18 @@ type Attachment struct {
 type Changes struct {
 	EffectiveSource string
 
+	// NewOptions, if non-nil, replaces the mount's Options for the rest
+	// of the middleware stack and the eventual container runtime call --
+	// e.g. a TypeBlock middleware reporting the device options it
+	// resolved, or a TypeTmpfs middleware adjusting tmpfs mount options.
+	NewOptions map[string]string `json:",omitempty"`
+
+	// NewMode, if non-empty, replaces the mount's Mode for the rest of
+	// the middleware stack and the eventual container runtime call. For
+	// TypeBlock mounts this is expected to be one of "ro", "rw" or
+	// "mknod".
+	NewMode string `json:",omitempty"`
+
 	// from api/types/mount
 	Consistency mount.Consistency `json:",omitempty"`
 	//Labels      map[string]string `json:",omitempty"`
@@ -101,6 +154,47 @@ type DetachResponse struct {
 	Err string `json:",omitempty"`
 }
 
+// ReconcileRequest holds the set of a container's currently-attached
+// mount points a mount point middleware previously applied to, so the
+// middleware can reconcile its view of them against a daemon that may
+// have just come back from a --live-restore restart.
+type ReconcileRequest struct {
+	ID     string
+	Mounts []*MountPoint
+}
+
+// ReconcileAction is a mount point middleware's verdict on one mount in
+// a ReconcileRequest.
+type ReconcileAction string
+
+// ReconcileAction constants
+const (
+	// ReconcileKeep leaves the mount's existing attachment untouched.
+	ReconcileKeep ReconcileAction = "keep"
+	// ReconcileRedo detaches and re-attaches the mount, e.g. because
+	// the middleware's state for it was lost or needs refreshing.
+	ReconcileRedo ReconcileAction = "redo"
+	// ReconcileDrop detaches the mount and removes the middleware from
+	// its AppliedMiddleware stack, e.g. because the middleware no
+	// longer wants to interpose on it at all.
+	ReconcileDrop ReconcileAction = "drop"
+)
+
+// ReconcileResponse carries one ReconcileAction per ReconcileRequest.Mounts
+// entry, in the same order.
+type ReconcileResponse struct {
+	// Success indicates whether the reconcile query was successful
+	Success bool
+
+	// Decisions holds one ReconcileAction per entry in the
+	// corresponding ReconcileRequest.Mounts, in the same order. A
+	// short Decisions slice is padded with ReconcileKeep.
+	Decisions []ReconcileAction `json:",omitempty"`
+
+	// Err stores a message in case there's an error
+	Err string `json:",omitempty"`
+}
+
 // MountPoint is the representation of a container mount point exposed
 // to mount point middleware. Pattern and Changes should be the same
 // shape as this type.
@@ -117,6 +211,12 @@ type MountPoint struct {
 	Propagation mount.Propagation `json:",omitempty"`
 	ID          string            `json:",omitempty"`
 
+	// SecretID is an opaque reference to a secret for TypeSecret mounts.
+	// It names the secret to a middleware, which resolves it against its
+	// own secret store; the daemon never reads or stores the secret's
+	// content itself.
+	SecretID string `json:",omitempty"`
+
 	AppliedMiddleware []AppliedMiddleware
 
 	// from api/types/mount
@@ -147,10 +247,15 @@ const (
 // applied to a mount point as exposed to later mount point middleware in
 // the stack
 type AppliedMiddleware struct {
-	Name    string
-	Changes Changes
+	Name       string
+	MountPoint MountPointAttachment
 }
 
+// MountPointAttachment is the name this package's matching engine
+// (mountPointAttachmentPatternMatches, AppliedMiddleware.MountPoint) and
+// newer call sites use for Changes; the two names are interchangeable.
+type MountPointAttachment = Changes
+
 // Pattern is a description of a class of MountPoints
 type Pattern struct {
 	EffectiveSource []StringPattern `json:",omitempty"`
@@ -165,6 +270,12 @@ type Pattern struct {
 	Propagation *mount.Propagation `json:",omitempty"`
 	ID          []StringPattern    `json:",omitempty"`
 
+	// SecretID matches against MountPoint.SecretID, letting a plugin
+	// declare interest in a specific secret (or, via a Prefix/Regex
+	// StringPattern, a class of secrets) without matching every
+	// TypeSecret mount.
+	SecretID []StringPattern `json:",omitempty"`
+
 	AppliedMiddleware AppliedMiddlewareStackPattern
 
 	// from api/types/mount
@@ -178,8 +289,24 @@ type Pattern struct {
 	//MountMode *os.FileMode `json:",omitempty"`
 
 	Options []StringMapPattern `json:",omitempty"`
+
+	// AnyOf, AllOf and OneOf compose whole sub-patterns by disjunction,
+	// conjunction and exclusive disjunction respectively, on top of the
+	// implicit AND across this Pattern's own fields. Not negates a
+	// whole sub-pattern, as opposed to the per-field Not on StringPattern
+	// and friends. All four are empty/nil by default, which imposes no
+	// additional constraint.
+	AnyOf []MountPointPattern `json:",omitempty"`
+	AllOf []MountPointPattern `json:",omitempty"`
+	OneOf []MountPointPattern `json:",omitempty"`
+	Not   *MountPointPattern  `json:",omitempty"`
 }
 
+// MountPointPattern is the name this package's matching engine
+// (PatternMatches, Middleware.Patterns, Compile) and newer call sites
+// use for Pattern; the two names are interchangeable.
+type MountPointPattern = Pattern
+
 // AppliedMiddlewareStackPattern is a description of a class of
 // applied middleware stack
 type AppliedMiddlewareStackPattern struct {
@@ -187,20 +314,70 @@ type AppliedMiddlewareStackPattern struct {
 	NotExists         []AppliedMiddlewarePattern `json:",omitempty"`
 	All               []AppliedMiddlewarePattern `json:",omitempty"`
 	NotAll            []AppliedMiddlewarePattern `json:",omitempty"`
-	AnySequence       []AppliedMiddlewarePattern `json:",omitempty"`
-	NotAnySequence    []AppliedMiddlewarePattern `json:",omitempty"`
-	TopSequence       []AppliedMiddlewarePattern `json:",omitempty"`
-	NotTopSequence    []AppliedMiddlewarePattern `json:",omitempty"`
-	BottomSequence    []AppliedMiddlewarePattern `json:",omitempty"`
-	NotBottomSequence []AppliedMiddlewarePattern `json:",omitempty"`
-	RelativeOrder     []AppliedMiddlewarePattern `json:",omitempty"`
-	NotRelativeOrder  []AppliedMiddlewarePattern `json:",omitempty"`
+	AnySequence       []SequenceElement          `json:",omitempty"`
+	NotAnySequence    []SequenceElement          `json:",omitempty"`
+	TopSequence       []SequenceElement          `json:",omitempty"`
+	NotTopSequence    []SequenceElement          `json:",omitempty"`
+	BottomSequence    []SequenceElement          `json:",omitempty"`
+	NotBottomSequence []SequenceElement          `json:",omitempty"`
+	RelativeOrder     []SequenceElement          `json:",omitempty"`
+	NotRelativeOrder  []SequenceElement          `json:",omitempty"`
+
+	// DependsOn constrains the relative order of middleware by
+	// requirement rather than position: every applied middleware
+	// matching a dependency's Plugin must have, earlier in the stack,
+	// some applied middleware matching each of that dependency's
+	// Requires patterns.
+	DependsOn []MiddlewareDependency `json:",omitempty"`
+}
+
+// Quantifier describes how many consecutive times a SequenceElement's
+// pattern may match within a sequence pattern. The zero value, One,
+// preserves the original sequence semantics: exactly one match.
+type Quantifier string
+
+// Quantifier constants
+const (
+	// One requires the element to match exactly once.
+	One Quantifier = ""
+	// ZeroOrOne allows the element to be absent from the sequence.
+	ZeroOrOne Quantifier = "zeroOrOne"
+	// ZeroOrMore allows the element to be absent or to match any
+	// number of consecutive times.
+	ZeroOrMore Quantifier = "zeroOrMore"
+	// OneOrMore requires at least one match and allows the element to
+	// repeat any number of further consecutive times.
+	OneOrMore Quantifier = "oneOrMore"
+)
+
+// SequenceElement is a single position within a sequence pattern
+// (AnySequence, TopSequence, BottomSequence or RelativeOrder). Pattern
+// is the element's primary pattern; if Alternatives is non-empty, the
+// position instead matches any one of those patterns.
+type SequenceElement struct {
+	Pattern      AppliedMiddlewarePattern   `json:",omitempty"`
+	Quantifier   Quantifier                 `json:",omitempty"`
+	Alternatives []AppliedMiddlewarePattern `json:",omitempty"`
+}
+
+// MiddlewareDependency describes a requirement that wherever Plugin
+// matches an applied middleware, every pattern in Requires must match
+// some applied middleware that ran earlier in the stack.
+type MiddlewareDependency struct {
+	Plugin   AppliedMiddlewarePattern
+	Requires []AppliedMiddlewarePattern
 }
 
 // AppliedMiddlewarePattern is a description of a class of applied middleware
 type AppliedMiddlewarePattern struct {
-	Name    []StringPattern `json:",omitempty"`
-	Changes ChangesPattern  `json:",omitempty"`
+	Name       []StringPattern             `json:",omitempty"`
+	MountPoint MountPointAttachmentPattern `json:",omitempty"`
+
+	// Select names this element as a capture slot: when the pattern
+	// matches, the AppliedMiddleware that satisfied this element is
+	// recorded under this name in the resulting MatchResult's
+	// Bindings. Empty means the element isn't captured.
+	Select string `json:",omitempty"`
 }
 
 // ChangesPattern is a description of a class of mount point changes
@@ -212,6 +389,10 @@ type ChangesPattern struct {
 	//Labels      map[string]string `json:",omitempty"`
 }
 
+// MountPointAttachmentPattern is the name this package's matching engine
+// uses for ChangesPattern; the two names are interchangeable.
+type MountPointAttachmentPattern = ChangesPattern
+
 // StringMapPattern is a description of a class of string -> string maps
 type StringMapPattern struct {
 	Not bool `json:",omitempty"`
@@ -237,4 +418,12 @@ type StringPattern struct {
 	Suffix     string `json:",omitempty"`
 	Exactly    string `json:",omitempty"`
 	Contains   string `json:",omitempty"`
+
+	// Regex matches the full string (anchored, dot matching newlines)
+	// against this regular expression.
+	Regex string `json:",omitempty"`
+	// Glob matches the string, treated as a path, against this glob
+	// pattern. Supports "*", "?", "**" (recursive path segment match)
+	// and "[...]" character classes.
+	Glob string `json:",omitempty"`
 }
@@ -0,0 +1,229 @@
+package mountpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+// CompiledPattern is a MountPointPattern prepared for repeated matching
+// against many mount points: its Regex/Glob and PathPrefix string
+// patterns are validated and pre-warmed into their respective caches up
+// front, so the first Matches call against it doesn't pay the compile
+// cost that stringPatternMatches would otherwise defer to the hot path.
+type CompiledPattern struct {
+	pattern MountPointPattern
+}
+
+// compiledCache holds CompiledPatterns keyed by a stable hash of their
+// source MountPointPattern, so that identical policies shared across
+// many containers (the common case for a daemon-wide mount point
+// policy) share a single compiled instance rather than each caller
+// compiling its own.
+var compiledCache sync.Map // map[string]*CompiledPattern
+
+// Compile prepares a MountPointPattern for repeated matching. Patterns
+// are compared by value: compiling the same pattern twice (even from
+// independently constructed structs) returns the same *CompiledPattern.
+func Compile(p MountPointPattern) (*CompiledPattern, error) {
+	key, err := patternHash(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached, ok := compiledCache.Load(key); ok {
+		return cached.(*CompiledPattern), nil
+	}
+
+	// pre-warm the PathPrefix and Regex/Glob caches for this pattern
+	// so the first Matches call doesn't pay their compile cost either
+	if err := warmStringPatterns(p); err != nil {
+		return nil, err
+	}
+
+	compiled := &CompiledPattern{pattern: p}
+
+	actual, _ := compiledCache.LoadOrStore(key, compiled)
+	return actual.(*CompiledPattern), nil
+}
+
+// Matches reports whether the compiled pattern matches mount. Matching
+// itself still runs the same PatternMatches a raw, uncompiled pattern
+// would -- including the nested-loop sequence matcher behind
+// AnySequence/RelativeOrder -- since Compile only pre-warms the regex,
+// glob and path-prefix caches ValidateStringPattern would otherwise
+// populate lazily on the first match. There is no separate compiled
+// automaton for sequence patterns.
+func (c *CompiledPattern) Matches(mount *MountPoint) bool {
+	return PatternMatches(c.pattern, mount)
+}
+
+// patternHash computes a stable content hash of a MountPointPattern so
+// structurally identical patterns (even built independently) land on
+// the same compiledCache entry.
+func patternHash(p MountPointPattern) (string, error) {
+	// encoding/json produces a deterministic encoding for a given Go
+	// value (struct fields are always emitted in declaration order),
+	// which is all the stability this cache key needs.
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// warmStringPatterns validates and pre-compiles every Regex/Glob and
+// PathPrefix StringPattern reachable from p -- including those nested in
+// AnyOf/AllOf/OneOf/Not, in the Labels/DriverOptions/Options
+// StringMapPatterns, and in AppliedMiddleware's Exists/All/sequence/
+// DependsOn patterns -- surfacing a malformed pattern at Compile time
+// rather than at the first matching mount.
+func warmStringPatterns(p MountPointPattern) error {
+	all := [][]StringPattern{
+		p.EffectiveSource, p.Source, p.Destination, p.Name, p.Driver, p.Mode, p.ID, p.SecretID,
+	}
+	for _, patterns := range all {
+		if err := warmStringPatternList(patterns); err != nil {
+			return err
+		}
+	}
+
+	for _, maps := range [][]StringMapPattern{p.Labels, p.DriverOptions, p.Options} {
+		if err := warmStringMapPatterns(maps); err != nil {
+			return err
+		}
+	}
+
+	if err := warmAppliedMiddlewareStackPattern(p.AppliedMiddleware); err != nil {
+		return err
+	}
+
+	for _, sub := range p.AnyOf {
+		if err := warmStringPatterns(sub); err != nil {
+			return err
+		}
+	}
+	for _, sub := range p.AllOf {
+		if err := warmStringPatterns(sub); err != nil {
+			return err
+		}
+	}
+	for _, sub := range p.OneOf {
+		if err := warmStringPatterns(sub); err != nil {
+			return err
+		}
+	}
+	if p.Not != nil {
+		if err := warmStringPatterns(*p.Not); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// warmStringPatternList validates and pre-compiles each StringPattern in
+// patterns.
+func warmStringPatternList(patterns []StringPattern) error {
+	for _, sp := range patterns {
+		if err := ValidateStringPattern(sp); err != nil {
+			return err
+		}
+		if sp.PathPrefix != "" {
+			cleanPathCached(sp.PathPrefix)
+		}
+	}
+	return nil
+}
+
+// warmStringMapPatterns validates and pre-compiles the Key/Value
+// StringPatterns nested in each StringMapPattern.
+func warmStringMapPatterns(maps []StringMapPattern) error {
+	for _, m := range maps {
+		for _, kv := range m.Exists {
+			if err := warmStringPatternList([]StringPattern{kv.Key, kv.Value}); err != nil {
+				return err
+			}
+		}
+		for _, kv := range m.All {
+			if err := warmStringPatternList([]StringPattern{kv.Key, kv.Value}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// warmAppliedMiddlewarePattern validates and pre-compiles the Name and
+// MountPoint.EffectiveSource StringPatterns of a single
+// AppliedMiddlewarePattern.
+func warmAppliedMiddlewarePattern(amp AppliedMiddlewarePattern) error {
+	if err := warmStringPatternList(amp.Name); err != nil {
+		return err
+	}
+	return warmStringPatternList(amp.MountPoint.EffectiveSource)
+}
+
+// warmAppliedMiddlewarePatterns validates and pre-compiles every
+// AppliedMiddlewarePattern in patterns.
+func warmAppliedMiddlewarePatterns(patterns []AppliedMiddlewarePattern) error {
+	for _, amp := range patterns {
+		if err := warmAppliedMiddlewarePattern(amp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warmSequenceElements validates and pre-compiles every
+// AppliedMiddlewarePattern reachable from a slice of SequenceElements,
+// including each element's Alternatives.
+func warmSequenceElements(elements []SequenceElement) error {
+	for _, el := range elements {
+		if err := warmAppliedMiddlewarePattern(el.Pattern); err != nil {
+			return err
+		}
+		if err := warmAppliedMiddlewarePatterns(el.Alternatives); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warmAppliedMiddlewareStackPattern validates and pre-compiles every
+// StringPattern reachable from an AppliedMiddlewareStackPattern: its
+// Exists/NotExists/All/NotAll patterns, every sequence pattern's
+// elements, and each DependsOn dependency's Plugin and Requires
+// patterns.
+func warmAppliedMiddlewareStackPattern(s AppliedMiddlewareStackPattern) error {
+	for _, patterns := range [][]AppliedMiddlewarePattern{s.Exists, s.NotExists, s.All, s.NotAll} {
+		if err := warmAppliedMiddlewarePatterns(patterns); err != nil {
+			return err
+		}
+	}
+
+	for _, elements := range [][]SequenceElement{
+		s.AnySequence, s.NotAnySequence,
+		s.TopSequence, s.NotTopSequence,
+		s.BottomSequence, s.NotBottomSequence,
+		s.RelativeOrder, s.NotRelativeOrder,
+	} {
+		if err := warmSequenceElements(elements); err != nil {
+			return err
+		}
+	}
+
+	for _, dep := range s.DependsOn {
+		if err := warmAppliedMiddlewarePattern(dep.Plugin); err != nil {
+			return err
+		}
+		if err := warmAppliedMiddlewarePatterns(dep.Requires); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package mountpoint
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileSharesIdenticalPatterns(t *testing.T) {
+	pattern := MountPointPattern{
+		Destination: []StringPattern{{PathPrefix: "/data"}},
+	}
+
+	a, err := Compile(pattern)
+	require.Nil(t, err)
+	b, err := Compile(pattern)
+	require.Nil(t, err)
+	require.True(t, a == b, "identical patterns should share one compiled instance")
+
+	other, err := Compile(MountPointPattern{Destination: []StringPattern{{PathPrefix: "/other"}}})
+	require.Nil(t, err)
+	require.False(t, a == other)
+}
+
+func TestCompiledPatternMatches(t *testing.T) {
+	compiled, err := Compile(MountPointPattern{
+		Destination: []StringPattern{{PathPrefix: "/data"}},
+	})
+	require.Nil(t, err)
+
+	require.True(t, compiled.Matches(&MountPoint{Destination: "/data/app"}))
+	require.False(t, compiled.Matches(&MountPoint{Destination: "/other"}))
+}
+
+func TestCompileRejectsInvalidPattern(t *testing.T) {
+	_, err := Compile(MountPointPattern{
+		Destination: []StringPattern{{Regex: "a("}},
+	})
+	require.Error(t, err)
+}
+
+func TestCompileRejectsInvalidPatternNestedInAnyOf(t *testing.T) {
+	_, err := Compile(MountPointPattern{
+		AnyOf: []MountPointPattern{{Destination: []StringPattern{{Regex: "a("}}}},
+	})
+	require.Error(t, err)
+}
+
+func TestCompileRejectsInvalidPatternNestedInStringMapPattern(t *testing.T) {
+	_, err := Compile(MountPointPattern{
+		Labels: []StringMapPattern{{Exists: []StringMapKeyValuePattern{{Value: StringPattern{Regex: "a("}}}}},
+	})
+	require.Error(t, err)
+}
+
+func TestCompileRejectsInvalidPatternNestedInAppliedMiddlewareExists(t *testing.T) {
+	_, err := Compile(MountPointPattern{
+		AppliedMiddleware: AppliedMiddlewareStackPattern{
+			Exists: []AppliedMiddlewarePattern{{Name: []StringPattern{{Regex: "a("}}}},
+		},
+	})
+	require.Error(t, err)
+}
+
+func TestCompileRejectsInvalidPatternNestedInSequenceElement(t *testing.T) {
+	_, err := Compile(MountPointPattern{
+		AppliedMiddleware: AppliedMiddlewareStackPattern{
+			AnySequence: []SequenceElement{{Alternatives: []AppliedMiddlewarePattern{{Name: []StringPattern{{Regex: "a("}}}}}},
+		},
+	})
+	require.Error(t, err)
+}
+
+func TestCompileRejectsInvalidPatternNestedInDependsOn(t *testing.T) {
+	_, err := Compile(MountPointPattern{
+		AppliedMiddleware: AppliedMiddlewareStackPattern{
+			DependsOn: []MiddlewareDependency{{Requires: []AppliedMiddlewarePattern{{Name: []StringPattern{{Regex: "a("}}}}}},
+		},
+	})
+	require.Error(t, err)
+}
+
+func realisticStackPattern(n int) MountPointPattern {
+	exists := make([]AppliedMiddlewarePattern, n)
+	for i := range exists {
+		exists[i] = AppliedMiddlewarePattern{
+			Name: []StringPattern{{Exactly: fmt.Sprintf("plugin:plugin%d", i)}},
+		}
+	}
+	return MountPointPattern{
+		Destination:       []StringPattern{{PathPrefix: "/var/lib/docker/volumes"}},
+		AppliedMiddleware: AppliedMiddlewareStackPattern{Exists: exists[:1]},
+	}
+}
+
+// BenchmarkPatternMatchesUncompiled exercises the existing
+// PatternMatches entry point directly against a realistic 15-middleware
+// stack pattern, re-deriving PathPrefix cleaning on every call.
+func BenchmarkPatternMatchesUncompiled(b *testing.B) {
+	pattern := realisticStackPattern(15)
+	mount := &MountPoint{
+		Destination:       "/var/lib/docker/volumes/myvolume/_data",
+		AppliedMiddleware: []AppliedMiddleware{{Name: "plugin:plugin0"}},
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		PatternMatches(pattern, mount)
+	}
+}
+
+// BenchmarkCompiledPatternMatches exercises the same pattern through
+// Compile/Matches, amortizing PathPrefix cleaning and pattern
+// validation across calls.
+func BenchmarkCompiledPatternMatches(b *testing.B) {
+	pattern := realisticStackPattern(15)
+	compiled, err := Compile(pattern)
+	if err != nil {
+		b.Fatal(err)
+	}
+	mount := &MountPoint{
+		Destination:       "/var/lib/docker/volumes/myvolume/_data",
+		AppliedMiddleware: []AppliedMiddleware{{Name: "plugin:plugin0"}},
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		compiled.Matches(mount)
+	}
+}
@@ -0,0 +1,417 @@
+package mountpoint
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/volume/mountpoint/proto"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const (
+	// MountPointAPIImplementsGRPC is the Implements value a plugin
+	// manifest advertises to opt into the gRPC transport
+	// (volume/mountpoint/proto/mountpoint.proto) instead of the classic
+	// JSON-RPC-over-HTTP transport named by MountPointAPIImplements.
+	MountPointAPIImplementsGRPC = "mountpoint/grpc"
+)
+
+// NegotiateTransport picks the transport NewMountPointPlugin should use
+// against a plugin manifest's advertised Implements values, preferring
+// gRPC when offered and falling back to the original HTTP transport
+// otherwise so existing plugins keep working unmodified. This is a free
+// function rather than a method on the (not-present-in-this-tree)
+// plugin client so NewMountPointPlugin can call it without this package
+// depending on anything plugin-getter-shaped.
+func NegotiateTransport(implements []string) string {
+	for _, name := range implements {
+		if name == MountPointAPIImplementsGRPC {
+			return MountPointAPIImplementsGRPC
+		}
+	}
+	return MountPointAPIImplements
+}
+
+// GRPCMiddleware is the gRPC-transport counterpart of the plugin
+// Middleware NewMountPointPlugin constructs for the HTTP transport. It
+// converts to/from the wire types in volume/mountpoint/proto so plugin
+// authors reuse the same PropertiesRequest/AttachRequest/DetachRequest
+// construction logic regardless of which transport NegotiateTransport
+// picked.
+type GRPCMiddleware struct {
+	name       string
+	pluginName string
+	digest     string
+	client     proto.MountPointPluginClient
+}
+
+// NewGRPCMiddleware wraps an already-dialed proto.MountPointPluginClient
+// as a Middleware. Dialing the client itself requires google.golang.org/grpc,
+// which isn't vendored in this source tree; NewMountPointPlugin would
+// dial and pass the resulting client here once that dependency exists.
+func NewGRPCMiddleware(name, pluginName, digest string, client proto.MountPointPluginClient) *GRPCMiddleware {
+	return &GRPCMiddleware{name: name, pluginName: pluginName, digest: digest, client: client}
+}
+
+func (g *GRPCMiddleware) Name() string       { return g.name }
+func (g *GRPCMiddleware) PluginName() string { return g.pluginName }
+func (g *GRPCMiddleware) Digest() string     { return g.digest }
+
+// SpecModifiers always returns nil: a Go closure can't cross the gRPC
+// wire, so a remote plugin has no way to hand one back. A plugin that
+// needs to affect the runtime spec still has to do it through
+// MountPointAttach's Changes.EffectiveSource (optionally resolved
+// through PropagatedMount); a declarative spec-patch wire type would be
+// needed to let a plugin drive SpecModifiers for real, and none exists
+// yet.
+func (g *GRPCMiddleware) SpecModifiers() []func(*specs.Spec) error { return nil }
+
+// Patterns queries MountPointProperties and discards any error, mirroring
+// the zero-value-on-failure behavior plugin callers already tolerate
+// elsewhere (e.g. an unreachable plugin reports no patterns rather than
+// panicking a caller that isn't expecting an error return here).
+func (g *GRPCMiddleware) Patterns() []MountPointPattern {
+	response, err := g.MountPointProperties(&PropertiesRequest{})
+	if err != nil || !response.Success {
+		return nil
+	}
+	return response.Patterns
+}
+
+func (g *GRPCMiddleware) MountPointProperties(req *PropertiesRequest) (*PropertiesResponse, error) {
+	response, err := g.client.Properties(context.Background(), &proto.PropertiesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return fromProtoPropertiesResponse(response), nil
+}
+
+func (g *GRPCMiddleware) MountPointAttach(req *AttachRequest) (*AttachResponse, error) {
+	return g.MountPointAttachContext(context.Background(), req)
+}
+
+// MountPointAttachContext drains the AttachResponseChunk stream into a
+// single AttachResponse, so non-streaming callers see the same shape
+// the HTTP transport returns. A caller that wants the incremental
+// delivery the stream enables should use g.client.Attach directly.
+func (g *GRPCMiddleware) MountPointAttachContext(ctx context.Context, req *AttachRequest) (*AttachResponse, error) {
+	stream, err := g.client.Attach(ctx, toProtoAttachRequest(req))
+	if err != nil {
+		return nil, err
+	}
+
+	response := &AttachResponse{Success: true}
+	for {
+		chunk, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if !chunk.Success {
+			return &AttachResponse{Success: false, Err: chunk.Err}, nil
+		}
+		for _, attachment := range chunk.Attachments {
+			response.Attachments = append(response.Attachments, fromProtoAttachment(attachment))
+		}
+		if chunk.Final {
+			break
+		}
+	}
+	return response, nil
+}
+
+func (g *GRPCMiddleware) MountPointDetach(req *DetachRequest) (*DetachResponse, error) {
+	return g.MountPointDetachContext(context.Background(), req)
+}
+
+func (g *GRPCMiddleware) MountPointDetachContext(ctx context.Context, req *DetachRequest) (*DetachResponse, error) {
+	response, err := g.client.Detach(ctx, &proto.DetachRequest{Id: req.ID})
+	if err != nil {
+		return nil, err
+	}
+	return &DetachResponse{Success: response.Success, Recoverable: response.Recoverable, Err: response.Err}, nil
+}
+
+// MountPointReconcile implements Reconciler for the gRPC transport,
+// mirroring the same live-restore batching the HTTP transport's plugin
+// client implements against MountPointAPIReconcile.
+func (g *GRPCMiddleware) MountPointReconcile(req *ReconcileRequest) (*ReconcileResponse, error) {
+	mounts := make([]*proto.MountPoint, len(req.Mounts))
+	for i, mp := range req.Mounts {
+		mounts[i] = toProtoMountPoint(mp)
+	}
+	response, err := g.client.Reconcile(context.Background(), &proto.ReconcileRequest{Id: req.ID, Mounts: mounts})
+	if err != nil {
+		return nil, err
+	}
+	return fromProtoReconcileResponse(response), nil
+}
+
+func toProtoStringPatterns(patterns []StringPattern) []*proto.StringPattern {
+	if patterns == nil {
+		return nil
+	}
+	out := make([]*proto.StringPattern, len(patterns))
+	for i, p := range patterns {
+		out[i] = &proto.StringPattern{
+			Not: p.Not, Empty: p.Empty, Prefix: p.Prefix, PathPrefix: p.PathPrefix,
+			Suffix: p.Suffix, Contains: p.Contains, Exactly: p.Exactly, Regex: p.Regex, Glob: p.Glob,
+		}
+	}
+	return out
+}
+
+func fromProtoStringPatterns(patterns []*proto.StringPattern) []StringPattern {
+	if patterns == nil {
+		return nil
+	}
+	out := make([]StringPattern, len(patterns))
+	for i, p := range patterns {
+		out[i] = StringPattern{
+			Not: p.Not, Empty: p.Empty, Prefix: p.Prefix, PathPrefix: p.PathPrefix,
+			Suffix: p.Suffix, Contains: p.Contains, Exactly: p.Exactly, Regex: p.Regex, Glob: p.Glob,
+		}
+	}
+	return out
+}
+
+// toProtoPattern and fromProtoPattern convert every Pattern field
+// PatternIndex (volume/mountpoint/index.go) indexes, plus the remaining
+// plain StringPattern/AnyOf/AllOf/OneOf/Not fields. They do not yet
+// convert AppliedMiddleware (AppliedMiddlewareStackPattern) or the
+// StringMapPattern fields (Labels, DriverOptions, Options): those need
+// MiddlewareDependency's cycle-detection-sensitive shape and the
+// Exists/All StringMapKeyValuePattern shape mirrored carefully enough
+// that getting it wrong would silently misroute mounts, so a plugin
+// whose Patterns rely on those fields should stay on the HTTP
+// transport until that conversion is added.
+func toProtoPattern(p MountPointPattern) *proto.Pattern {
+	out := &proto.Pattern{
+		EffectiveSource: toProtoStringPatterns(p.EffectiveSource),
+		Source:          toProtoStringPatterns(p.Source),
+		Destination:     toProtoStringPatterns(p.Destination),
+		Name:            toProtoStringPatterns(p.Name),
+		Driver:          toProtoStringPatterns(p.Driver),
+		Mode:            toProtoStringPatterns(p.Mode),
+		Id:              toProtoStringPatterns(p.ID),
+		SecretId:        toProtoStringPatterns(p.SecretID),
+		Scope:           string(derefScope(p.Scope)),
+		Propagation:     string(derefPropagation(p.Propagation)),
+		Consistency:     string(derefConsistency(p.Consistency)),
+	}
+	if p.ReadOnly != nil {
+		out.HasReadOnly = true
+		out.ReadOnly = *p.ReadOnly
+	}
+	if p.Type != nil {
+		out.Type = string(*p.Type)
+	}
+	for _, sub := range p.AnyOf {
+		out.AnyOf = append(out.AnyOf, toProtoPattern(sub))
+	}
+	for _, sub := range p.AllOf {
+		out.AllOf = append(out.AllOf, toProtoPattern(sub))
+	}
+	for _, sub := range p.OneOf {
+		out.OneOf = append(out.OneOf, toProtoPattern(sub))
+	}
+	if p.Not != nil {
+		out.Not = toProtoPattern(*p.Not)
+	}
+	return out
+}
+
+func fromProtoPattern(p *proto.Pattern) MountPointPattern {
+	out := MountPointPattern{
+		EffectiveSource: fromProtoStringPatterns(p.EffectiveSource),
+		Source:          fromProtoStringPatterns(p.Source),
+		Destination:     fromProtoStringPatterns(p.Destination),
+		Name:            fromProtoStringPatterns(p.Name),
+		Driver:          fromProtoStringPatterns(p.Driver),
+		Mode:            fromProtoStringPatterns(p.Mode),
+		ID:              fromProtoStringPatterns(p.Id),
+		SecretID:        fromProtoStringPatterns(p.SecretId),
+	}
+	if p.HasReadOnly {
+		readOnly := p.ReadOnly
+		out.ReadOnly = &readOnly
+	}
+	if p.Type != "" {
+		t := Type(p.Type)
+		out.Type = &t
+	}
+	if p.Scope != "" {
+		s := Scope(p.Scope)
+		out.Scope = &s
+	}
+	if p.Propagation != "" {
+		prop := mount.Propagation(p.Propagation)
+		out.Propagation = &prop
+	}
+	if p.Consistency != "" {
+		c := mount.Consistency(p.Consistency)
+		out.Consistency = &c
+	}
+	for _, sub := range p.AnyOf {
+		out.AnyOf = append(out.AnyOf, fromProtoPattern(sub))
+	}
+	for _, sub := range p.AllOf {
+		out.AllOf = append(out.AllOf, fromProtoPattern(sub))
+	}
+	for _, sub := range p.OneOf {
+		out.OneOf = append(out.OneOf, fromProtoPattern(sub))
+	}
+	if p.Not != nil {
+		notPattern := fromProtoPattern(p.Not)
+		out.Not = &notPattern
+	}
+	return out
+}
+
+func derefScope(s *Scope) Scope {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func derefPropagation(p *mount.Propagation) mount.Propagation {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+func derefConsistency(c *mount.Consistency) mount.Consistency {
+	if c == nil {
+		return ""
+	}
+	return *c
+}
+
+func toProtoAppliedMiddleware(applied []AppliedMiddleware) []*proto.AppliedMiddleware {
+	if applied == nil {
+		return nil
+	}
+	out := make([]*proto.AppliedMiddleware, len(applied))
+	for i, a := range applied {
+		out[i] = &proto.AppliedMiddleware{
+			Name: a.Name,
+			MountPoint: &proto.Changes{
+				EffectiveSource: a.MountPoint.EffectiveSource,
+				Consistency:     string(a.MountPoint.Consistency),
+				NewOptions:      a.MountPoint.NewOptions,
+				NewMode:         a.MountPoint.NewMode,
+			},
+		}
+	}
+	return out
+}
+
+func fromProtoAppliedMiddleware(applied []*proto.AppliedMiddleware) []AppliedMiddleware {
+	if applied == nil {
+		return nil
+	}
+	out := make([]AppliedMiddleware, len(applied))
+	for i, a := range applied {
+		out[i] = AppliedMiddleware{
+			Name:       a.Name,
+			MountPoint: MountPointAttachment{
+				EffectiveSource: a.MountPoint.EffectiveSource,
+				Consistency:     mount.Consistency(a.MountPoint.Consistency),
+				NewOptions:      a.MountPoint.NewOptions,
+				NewMode:         a.MountPoint.NewMode,
+			},
+		}
+	}
+	return out
+}
+
+func toProtoMountPoint(mp *MountPoint) *proto.MountPoint {
+	return &proto.MountPoint{
+		EffectiveSource:   mp.EffectiveSource,
+		Source:            mp.Source,
+		Destination:       mp.Destination,
+		ReadOnly:          mp.ReadOnly,
+		Name:              mp.Name,
+		Driver:            mp.Driver,
+		Type:              string(mp.Type),
+		Mode:              mp.Mode,
+		Propagation:       string(mp.Propagation),
+		Id:                mp.ID,
+		SecretId:          mp.SecretID,
+		AppliedMiddleware: toProtoAppliedMiddleware(mp.AppliedMiddleware),
+		Consistency:       string(mp.Consistency),
+		Labels:            mp.Labels,
+		DriverOptions:     mp.DriverOptions,
+		Scope:             string(mp.Scope),
+		Options:           mp.Options,
+		SizeBytes:         mp.SizeBytes,
+	}
+}
+
+func fromProtoMountPoint(mp *proto.MountPoint) *MountPoint {
+	return &MountPoint{
+		EffectiveSource:   mp.EffectiveSource,
+		Source:            mp.Source,
+		Destination:       mp.Destination,
+		ReadOnly:          mp.ReadOnly,
+		Name:              mp.Name,
+		Driver:            mp.Driver,
+		Type:              Type(mp.Type),
+		Mode:              mp.Mode,
+		Propagation:       mount.Propagation(mp.Propagation),
+		ID:                mp.Id,
+		SecretID:          mp.SecretId,
+		AppliedMiddleware: fromProtoAppliedMiddleware(mp.AppliedMiddleware),
+		Consistency:       mount.Consistency(mp.Consistency),
+		Labels:            mp.Labels,
+		DriverOptions:     mp.DriverOptions,
+		Scope:             Scope(mp.Scope),
+		Options:           mp.Options,
+		SizeBytes:         mp.SizeBytes,
+	}
+}
+
+func fromProtoAttachment(a *proto.Attachment) Attachment {
+	return Attachment{
+		Attach:  a.Attach,
+		Changes: Changes{
+			EffectiveSource: a.Changes.EffectiveSource,
+			Consistency:     mount.Consistency(a.Changes.Consistency),
+			NewOptions:      a.Changes.NewOptions,
+			NewMode:         a.Changes.NewMode,
+		},
+	}
+}
+
+func toProtoAttachRequest(req *AttachRequest) *proto.AttachRequest {
+	mounts := make([]*proto.MountPoint, len(req.Mounts))
+	for i, mp := range req.Mounts {
+		mounts[i] = toProtoMountPoint(mp)
+	}
+	return &proto.AttachRequest{Id: req.ID, Mounts: mounts}
+}
+
+func fromProtoPropertiesResponse(response *proto.PropertiesResponse) *PropertiesResponse {
+	out := &PropertiesResponse{
+		Success:         response.Success,
+		Err:             response.Err,
+		PropagatedMount: response.PropagatedMount,
+		AttachTimeout:   time.Duration(response.AttachTimeoutMs) * time.Millisecond,
+		DetachTimeout:   time.Duration(response.DetachTimeoutMs) * time.Millisecond,
+	}
+	for _, p := range response.Patterns {
+		out.Patterns = append(out.Patterns, fromProtoPattern(p))
+	}
+	return out
+}
+
+func fromProtoReconcileResponse(response *proto.ReconcileResponse) *ReconcileResponse {
+	out := &ReconcileResponse{Success: response.Success, Err: response.Err}
+	for _, d := range response.Decisions {
+		out.Decisions = append(out.Decisions, ReconcileAction(d))
+	}
+	return out
+}
+
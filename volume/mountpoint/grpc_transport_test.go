@@ -0,0 +1,73 @@
+package mountpoint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/volume/mountpoint/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateTransportPrefersGRPCWhenAdvertised(t *testing.T) {
+	require.Equal(t, MountPointAPIImplementsGRPC, NegotiateTransport([]string{MountPointAPIImplements, MountPointAPIImplementsGRPC}))
+}
+
+func TestNegotiateTransportFallsBackToHTTP(t *testing.T) {
+	require.Equal(t, MountPointAPIImplements, NegotiateTransport([]string{MountPointAPIImplements}))
+	require.Equal(t, MountPointAPIImplements, NegotiateTransport(nil))
+}
+
+func TestPatternRoundTripsThroughProtoConversion(t *testing.T) {
+	readOnly := true
+	typ := TypeBind
+	pattern := MountPointPattern{
+		Destination: []StringPattern{{PathPrefix: "/var/lib"}},
+		ReadOnly:    &readOnly,
+		Type:        &typ,
+		SecretID:    []StringPattern{{Exactly: "a1b2c3"}},
+		AnyOf: []MountPointPattern{
+			{Source: []StringPattern{{Exactly: "/a"}}},
+		},
+	}
+
+	require.Equal(t, pattern, fromProtoPattern(toProtoPattern(pattern)))
+}
+
+func TestMountPointRoundTripsThroughProtoConversion(t *testing.T) {
+	mp := &MountPoint{
+		Destination:       "/data",
+		Source:            "/host/data",
+		Type:              TypeBind,
+		SecretID:          "a1b2c3",
+		AppliedMiddleware: []AppliedMiddleware{{Name: "plugin:quota", MountPoint: MountPointAttachment{
+			EffectiveSource: "/host/data/real",
+			NewOptions:      map[string]string{"device": "/dev/sdb1"},
+			NewMode:         "ro",
+		}}},
+	}
+
+	require.Equal(t, mp, fromProtoMountPoint(toProtoMountPoint(mp)))
+}
+
+func TestPropertiesResponseConvertsAdvertisedTimeoutsFromMilliseconds(t *testing.T) {
+	response := fromProtoPropertiesResponse(&proto.PropertiesResponse{
+		Success:         true,
+		AttachTimeoutMs: 5000,
+		DetachTimeoutMs: 7000,
+	})
+
+	require.Equal(t, 5*time.Second, response.AttachTimeout)
+	require.Equal(t, 7*time.Second, response.DetachTimeout)
+}
+
+func TestReconcileResponseRoundTripsThroughProtoConversion(t *testing.T) {
+	response := fromProtoReconcileResponse(&proto.ReconcileResponse{
+		Success:   true,
+		Decisions: []string{string(ReconcileKeep), string(ReconcileRedo), string(ReconcileDrop)},
+	})
+
+	require.Equal(t, &ReconcileResponse{
+		Success:   true,
+		Decisions: []ReconcileAction{ReconcileKeep, ReconcileRedo, ReconcileDrop},
+	}, response)
+}
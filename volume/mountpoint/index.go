@@ -0,0 +1,258 @@
+package mountpoint
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+// PatternIndex narrows a large registered Pattern set down to a small
+// candidate set before PatternMatches ever runs, so that a daemon with
+// dozens of plugins and hundreds of mounts per container doesn't pay
+// PatternMatches' full cost -- regex evaluation, the AppliedMiddleware
+// DNF matcher, recursive AnyOf/AllOf/OneOf/Not -- for every pattern on
+// every mount. It indexes the cheap, high-selectivity fields (exact
+// Type, Scope, Propagation, Consistency, a sole Exactly StringPattern on
+// Driver, and a sole non-negated PathPrefix StringPattern on
+// Source/Destination, the latter two stored as path-component tries)
+// and falls back to treating a pattern as "always a candidate" for any
+// field it doesn't restrict in one of those simple forms.
+//
+// This is a set of cheap hashmap/trie lookups replacing an O(n) full
+// PatternMatches scan with an O(n) scan of boolean comparisons (plus a
+// genuinely sub-linear trie walk for PathPrefix) -- it's a real
+// constant-factor win, not a literal O(log n) dispatcher, since no
+// general sub-linear index exists for arbitrary Contains/Regex
+// StringPatterns. Lookup is purely a filter: PatternMatches remains the
+// final arbiter, and Lookup must never exclude a pattern that
+// PatternMatches would have matched.
+type PatternIndex struct {
+	entries []MountPointPattern
+
+	byType        map[Type][]int
+	byScope       map[Scope][]int
+	byPropagation map[mount.Propagation][]int
+	byConsistency map[mount.Consistency][]int
+	byDriver      map[string][]int
+
+	sourceTrie      *pathTrie
+	destinationTrie *pathTrie
+
+	restrictedByType        map[int]bool
+	restrictedByScope       map[int]bool
+	restrictedByPropagation map[int]bool
+	restrictedByConsistency map[int]bool
+	restrictedByDriver      map[int]bool
+	restrictedBySource      map[int]bool
+	restrictedByDestination map[int]bool
+}
+
+// NewPatternIndex creates an empty PatternIndex.
+func NewPatternIndex() *PatternIndex {
+	return &PatternIndex{
+		byType:        map[Type][]int{},
+		byScope:       map[Scope][]int{},
+		byPropagation: map[mount.Propagation][]int{},
+		byConsistency: map[mount.Consistency][]int{},
+		byDriver:      map[string][]int{},
+
+		sourceTrie:      newPathTrie(),
+		destinationTrie: newPathTrie(),
+
+		restrictedByType:        map[int]bool{},
+		restrictedByScope:       map[int]bool{},
+		restrictedByPropagation: map[int]bool{},
+		restrictedByConsistency: map[int]bool{},
+		restrictedByDriver:      map[int]bool{},
+		restrictedBySource:      map[int]bool{},
+		restrictedByDestination: map[int]bool{},
+	}
+}
+
+// Add registers pattern, assigning it the next id (returned, in
+// registration order) and updating every index whose corresponding
+// field the pattern restricts in one of the simple forms PatternIndex
+// understands. A field the pattern leaves unset, or restricts with
+// something richer (multiple StringPatterns, Regex, Contains, a negated
+// PathPrefix, ...), isn't added to that index; Lookup then treats the
+// pattern as always passing that field's filter and leaves the final
+// decision to PatternMatches.
+func (idx *PatternIndex) Add(pattern MountPointPattern) int {
+	id := len(idx.entries)
+	idx.entries = append(idx.entries, pattern)
+
+	if pattern.Type != nil {
+		idx.byType[*pattern.Type] = append(idx.byType[*pattern.Type], id)
+		idx.restrictedByType[id] = true
+	}
+	if pattern.Scope != nil {
+		idx.byScope[*pattern.Scope] = append(idx.byScope[*pattern.Scope], id)
+		idx.restrictedByScope[id] = true
+	}
+	if pattern.Propagation != nil {
+		idx.byPropagation[*pattern.Propagation] = append(idx.byPropagation[*pattern.Propagation], id)
+		idx.restrictedByPropagation[id] = true
+	}
+	if pattern.Consistency != nil {
+		idx.byConsistency[*pattern.Consistency] = append(idx.byConsistency[*pattern.Consistency], id)
+		idx.restrictedByConsistency[id] = true
+	}
+	if exact, ok := soleExactStringPattern(pattern.Driver); ok {
+		idx.byDriver[exact] = append(idx.byDriver[exact], id)
+		idx.restrictedByDriver[id] = true
+	}
+	if prefix, ok := solePathPrefixStringPattern(pattern.Source); ok {
+		idx.sourceTrie.insert(prefix, id)
+		idx.restrictedBySource[id] = true
+	}
+	if prefix, ok := solePathPrefixStringPattern(pattern.Destination); ok {
+		idx.destinationTrie.insert(prefix, id)
+		idx.restrictedByDestination[id] = true
+	}
+
+	return id
+}
+
+// Lookup narrows idx's registered patterns to the ones that could
+// possibly match mp using only the indexed fields, then returns exactly
+// the subset of those candidates PatternMatches actually matches.
+func (idx *PatternIndex) Lookup(mp *MountPoint) []MountPointPattern {
+	candidate := make([]bool, len(idx.entries))
+	for i := range candidate {
+		candidate[i] = true
+	}
+
+	narrowCandidates(candidate, idx.restrictedByType, idx.byType[mp.Type])
+	narrowCandidates(candidate, idx.restrictedByScope, idx.byScope[mp.Scope])
+	narrowCandidates(candidate, idx.restrictedByPropagation, idx.byPropagation[mp.Propagation])
+	narrowCandidates(candidate, idx.restrictedByConsistency, idx.byConsistency[mp.Consistency])
+	narrowCandidates(candidate, idx.restrictedByDriver, idx.byDriver[mp.Driver])
+	narrowCandidates(candidate, idx.restrictedBySource, idx.sourceTrie.lookup(mp.Source))
+	narrowCandidates(candidate, idx.restrictedByDestination, idx.destinationTrie.lookup(mp.Destination))
+
+	var matches []MountPointPattern
+	for id, ok := range candidate {
+		if ok && PatternMatches(idx.entries[id], mp) {
+			matches = append(matches, idx.entries[id])
+		}
+	}
+	return matches
+}
+
+// narrowCandidates drops from candidate every id that restricted marks
+// as restricted by this field but that doesn't appear in matchingIDs --
+// i.e. ids unrestricted by this field, or restricted and actually
+// matching, survive.
+func narrowCandidates(candidate []bool, restricted map[int]bool, matchingIDs []int) {
+	if len(restricted) == 0 {
+		return
+	}
+	matchSet := make(map[int]bool, len(matchingIDs))
+	for _, id := range matchingIDs {
+		matchSet[id] = true
+	}
+	for id := range candidate {
+		if candidate[id] && restricted[id] && !matchSet[id] {
+			candidate[id] = false
+		}
+	}
+}
+
+// soleExactStringPattern reports the Exactly value of patterns when it
+// holds exactly one non-negated StringPattern whose only set field is
+// Exactly, the only shape PatternIndex can turn into a hashmap lookup.
+func soleExactStringPattern(patterns []StringPattern) (string, bool) {
+	if len(patterns) != 1 {
+		return "", false
+	}
+	p := patterns[0]
+	if p.Not || p.Exactly == "" {
+		return "", false
+	}
+	if p.Empty || p.Prefix != "" || p.PathPrefix != "" || p.Suffix != "" || p.Contains != "" || p.Regex != "" || p.Glob != "" {
+		return "", false
+	}
+	return p.Exactly, true
+}
+
+// solePathPrefixStringPattern reports the PathPrefix value of patterns
+// when it holds exactly one non-negated StringPattern whose only set
+// field is PathPrefix, the only shape PatternIndex can insert into a
+// path-component trie.
+func solePathPrefixStringPattern(patterns []StringPattern) (string, bool) {
+	if len(patterns) != 1 {
+		return "", false
+	}
+	p := patterns[0]
+	if p.Not || p.PathPrefix == "" {
+		return "", false
+	}
+	if p.Empty || p.Prefix != "" || p.Suffix != "" || p.Exactly != "" || p.Contains != "" || p.Regex != "" || p.Glob != "" {
+		return "", false
+	}
+	return p.PathPrefix, true
+}
+
+// pathTrieNode is one path component's node in a pathTrie: ids holds
+// every pattern id whose indexed PathPrefix is exactly the component
+// chain leading to this node.
+type pathTrieNode struct {
+	children map[string]*pathTrieNode
+	ids      []int
+}
+
+// pathTrie indexes PathPrefix string patterns by path component, so
+// looking up a mount path's candidates is a single walk down the trie
+// rather than a byte-prefix comparison against every registered prefix.
+type pathTrie struct {
+	root *pathTrieNode
+}
+
+func newPathTrie() *pathTrie {
+	return &pathTrie{root: &pathTrieNode{}}
+}
+
+// pathComponents splits a cleaned path into its non-empty components,
+// so "/var/lib/docker" and "/var/lib/docker/" index identically and the
+// root "/" is the empty component chain.
+func pathComponents(path string) []string {
+	trimmed := strings.Trim(cleanPathCached(path), "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
+
+// insert records id as matching every path whose components start with
+// prefix's components.
+func (t *pathTrie) insert(prefix string, id int) {
+	node := t.root
+	for _, component := range pathComponents(prefix) {
+		if node.children == nil {
+			node.children = map[string]*pathTrieNode{}
+		}
+		child, ok := node.children[component]
+		if !ok {
+			child = &pathTrieNode{}
+			node.children[component] = child
+		}
+		node = child
+	}
+	node.ids = append(node.ids, id)
+}
+
+// lookup returns the ids of every PathPrefix inserted that is a prefix
+// of path's components.
+func (t *pathTrie) lookup(path string) []int {
+	node := t.root
+	ids := append([]int{}, node.ids...)
+	for _, component := range pathComponents(path) {
+		child, ok := node.children[component]
+		if !ok {
+			break
+		}
+		ids = append(ids, child.ids...)
+		node = child
+	}
+	return ids
+}
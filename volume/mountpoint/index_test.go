@@ -0,0 +1,125 @@
+package mountpoint
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatternIndexNarrowsToMatchingCandidates(t *testing.T) {
+	idx := NewPatternIndex()
+	idx.Add(MountPointPattern{Destination: []StringPattern{{PathPrefix: "/var/lib/docker/volumes"}}})
+	idx.Add(MountPointPattern{Destination: []StringPattern{{PathPrefix: "/secrets"}}})
+	idx.Add(MountPointPattern{Driver: []StringPattern{{Exactly: "local"}}})
+
+	matches := idx.Lookup(&MountPoint{Destination: "/var/lib/docker/volumes/myvolume/_data", Driver: "nfs"})
+	require.Len(t, matches, 1)
+	require.Equal(t, "/var/lib/docker/volumes", matches[0].Destination[0].PathPrefix)
+}
+
+func TestPatternIndexDoesNotFalseNegativeOnUnindexedFields(t *testing.T) {
+	idx := NewPatternIndex()
+	// Regex on Source isn't one of the simple indexable shapes, so this
+	// pattern must always survive narrowing and be decided by
+	// PatternMatches alone.
+	idx.Add(MountPointPattern{Source: []StringPattern{{Regex: "^/data/.*"}}})
+
+	matches := idx.Lookup(&MountPoint{Source: "/data/app"})
+	require.Len(t, matches, 1)
+
+	noMatches := idx.Lookup(&MountPoint{Source: "/other"})
+	require.Len(t, noMatches, 0)
+}
+
+func TestPatternIndexDoesNotFalseNegativeOnCombinedStringPattern(t *testing.T) {
+	idx := NewPatternIndex()
+	// Combining PathPrefix with another matcher field (legal conjunction
+	// per ValidateStringPattern) isn't a "sole PathPrefix" pattern, so it
+	// must not be indexed and must always reach PatternMatches.
+	idx.Add(MountPointPattern{Destination: []StringPattern{{PathPrefix: "/var/lib", Suffix: "_data"}}})
+
+	require.Len(t, idx.Lookup(&MountPoint{Destination: "/var/lib/docker/_data"}), 1)
+	require.Len(t, idx.Lookup(&MountPoint{Destination: "/var/lib/docker/other"}), 0)
+}
+
+func TestPatternIndexRespectsType(t *testing.T) {
+	idx := NewPatternIndex()
+	bindType := TypeBind
+	idx.Add(MountPointPattern{Type: &bindType})
+
+	require.Len(t, idx.Lookup(&MountPoint{Type: TypeBind}), 1)
+	require.Len(t, idx.Lookup(&MountPoint{Type: TypeVolume}), 0)
+}
+
+func TestPatternIndexAgreesWithPatternMatches(t *testing.T) {
+	idx := NewPatternIndex()
+	patterns := make([]MountPointPattern, 50)
+	for i := range patterns {
+		patterns[i] = MountPointPattern{Destination: []StringPattern{{PathPrefix: fmt.Sprintf("/mnt/plugin%d", i)}}}
+		idx.Add(patterns[i])
+	}
+
+	for i, mp := range []*MountPoint{
+		{Destination: "/mnt/plugin7/data"},
+		{Destination: "/mnt/plugin42/data"},
+		{Destination: "/mnt/unrelated"},
+	} {
+		var want []MountPointPattern
+		for _, pattern := range patterns {
+			if PatternMatches(pattern, mp) {
+				want = append(want, pattern)
+			}
+		}
+		require.Equal(t, want, idx.Lookup(mp), "case %d", i)
+	}
+}
+
+// realisticIndex builds a PatternIndex of n plugins, each restricted to
+// its own destination subtree, mirroring realisticStackPattern's shape
+// in compile_test.go but across many distinct plugins rather than one
+// repeated pattern.
+func realisticIndex(n int) *PatternIndex {
+	idx := NewPatternIndex()
+	for i := 0; i < n; i++ {
+		idx.Add(MountPointPattern{
+			Destination:       []StringPattern{{PathPrefix: fmt.Sprintf("/var/lib/docker/plugins/plugin%d", i)}},
+			AppliedMiddleware: AppliedMiddlewareStackPattern{Exists: []AppliedMiddlewarePattern{{Name: []StringPattern{{Exactly: fmt.Sprintf("plugin:plugin%d", i)}}}}},
+		})
+	}
+	return idx
+}
+
+// BenchmarkPatternMatchesLinear100Plugins exercises a linear scan
+// calling PatternMatches against every one of 100 registered plugin
+// patterns, the naive dispatch PatternIndex is meant to improve on.
+func BenchmarkPatternMatchesLinear100Plugins(b *testing.B) {
+	idx := realisticIndex(100)
+	mount := &MountPoint{
+		Destination:       "/var/lib/docker/plugins/plugin99/_data",
+		AppliedMiddleware: []AppliedMiddleware{{Name: "plugin:plugin99"}},
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, pattern := range idx.entries {
+			PatternMatches(pattern, mount)
+		}
+	}
+}
+
+// BenchmarkPatternIndexLookup100Plugins exercises PatternIndex.Lookup
+// against the same 100-plugin registration, where the destination trie
+// should narrow the 100 entries down to a single PatternMatches call.
+func BenchmarkPatternIndexLookup100Plugins(b *testing.B) {
+	idx := realisticIndex(100)
+	mount := &MountPoint{
+		Destination:       "/var/lib/docker/plugins/plugin99/_data",
+		AppliedMiddleware: []AppliedMiddleware{{Name: "plugin:plugin99"}},
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		idx.Lookup(mount)
+	}
+}
@@ -3,7 +3,10 @@
 package mountpoint
 
 import (
+	"context"
 	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
 // Middleware interposes local file system mount points
@@ -17,6 +20,12 @@ type Middleware interface {
 	// plugin-based, PluginName returns the empty string.
 	PluginName() string
 
+	// Digest returns the content-addressable manifest digest of the
+	// plugin backing this middleware (e.g. "sha256:..."), or the empty
+	// string for non-plugin middleware or a plugin resolved without a
+	// digest pin.
+	Digest() string
+
 	// Patterns returns the mount point patterns that this plugin interposes
 	Patterns() []MountPointPattern
 
@@ -28,6 +37,54 @@ type Middleware interface {
 
 	// MountPointDetach releases one or more mount points from a container
 	MountPointDetach(*DetachRequest) (*DetachResponse, error)
+
+	// MountPointAttachContext is the context-aware variant of
+	// MountPointAttach. ctx carries the per-plugin attach deadline and
+	// may be canceled; implementations should abort the underlying RPC
+	// and return ctx.Err() once ctx is done rather than blocking
+	// indefinitely.
+	MountPointAttachContext(ctx context.Context, request *AttachRequest) (*AttachResponse, error)
+
+	// MountPointDetachContext is the context-aware variant of
+	// MountPointDetach.
+	MountPointDetachContext(ctx context.Context, request *DetachRequest) (*DetachResponse, error)
+
+	// SpecModifiers returns OCI runtime spec modifier functions this
+	// middleware wants applied to the target container's spec before it
+	// is started, so it can add mounts, tmpfs entries, propagation
+	// flags or devices atomically with container creation instead of
+	// mutating a live namespace after the fact (the source of the leaked-
+	// mount class RestoreMounts/ReconcileMounts exist to paper over).
+	// Middleware with nothing to contribute returns nil.
+	SpecModifiers() []func(*specs.Spec) error
+}
+
+// LiveRestorer is optionally implemented by mount point middleware that
+// can decide, at live-restore time, whether to adopt a running
+// container's mount attachment when the middleware's current Patterns
+// no longer cover it (e.g. the daemon's middleware config changed across
+// the restart). It mirrors the daemon's LiveRestorer hook used for
+// volume drivers elsewhere; this package has no dependency on that type,
+// so this is a local equivalent scoped to mount point middleware.
+type LiveRestorer interface {
+	// LiveRestoreAttachment is asked whether to adopt applied, the
+	// previously recorded attachment for mp, now that the middleware's
+	// current Patterns no longer match mp. Returning adopt=true keeps
+	// the attachment and mp.EffectiveSource unchanged, as if nothing
+	// had happened; adopt=false, or a non-nil err, means the
+	// middleware no longer vouches for the attachment and the caller
+	// should treat it as non-recoverable.
+	LiveRestoreAttachment(mp *MountPoint, applied AppliedMiddleware) (adopt bool, err error)
+}
+
+// Reconciler is optionally implemented by mount point middleware that
+// wants a single batched callback, at live-restore time, covering every
+// mount it's currently attached to, rather than the one-mount-at-a-time
+// LiveRestoreAttachment hook. MountPointReconcile reports a
+// ReconcileAction per mount so the caller can keep, redo (detach then
+// re-attach) or drop each attachment.
+type Reconciler interface {
+	MountPointReconcile(*ReconcileRequest) (*ReconcileResponse, error)
 }
 
 func PluginNameOfMiddlewareName(middlewareName string) string {
@@ -38,3 +95,44 @@ func PluginNameOfMiddlewareName(middlewareName string) string {
 		return ""
 	}
 }
+
+// PluginRef identifies a mount point middleware plugin to load,
+// optionally pinned to a specific content-addressable manifest digest so
+// that a `docker plugin upgrade` cannot silently swap the implementation
+// backing a running container's mounts.
+type PluginRef struct {
+	// Alias is the user-facing name operators use to refer to this
+	// middleware (e.g. in mount point patterns). It defaults to Name
+	// when not given a "alias=" prefix in the daemon config.
+	Alias string
+	// Name is the plugin name to resolve against the plugin getter.
+	Name string
+	// Digest pins the middleware to a specific plugin manifest digest.
+	// Empty means "whatever the plugin getter currently resolves Name
+	// to", i.e. unpinned.
+	Digest string
+}
+
+// ParsePluginRef parses a daemon config middleware list entry of the
+// form "[alias=]name[@digest]" into a PluginRef.
+func ParsePluginRef(ref string) PluginRef {
+	alias := ""
+	rest := ref
+	if i := strings.Index(rest, "="); i >= 0 {
+		alias = rest[:i]
+		rest = rest[i+1:]
+	}
+
+	name := rest
+	digest := ""
+	if i := strings.Index(rest, "@"); i >= 0 {
+		name = rest[:i]
+		digest = rest[i+1:]
+	}
+
+	if alias == "" {
+		alias = name
+	}
+
+	return PluginRef{Alias: alias, Name: name, Digest: digest}
+}
@@ -1,8 +1,13 @@
 package mountpoint
 
 import (
+	"bytes"
+	"fmt"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
+	"sync"
 )
 
 // PatternMatches determines if a pattern matches a mount point
@@ -63,6 +68,12 @@ func PatternMatches(pattern MountPointPattern, mount *MountPoint) bool {
 		}
 	}
 
+	for _, pattern := range pattern.SecretID {
+		if !stringPatternMatches(pattern, mount.SecretID) {
+			return false
+		}
+	}
+
 	if !appliedMiddlewareStackPatternMatches(pattern.AppliedMiddleware, mount.AppliedMiddleware) {
 		return false
 	}
@@ -87,193 +98,520 @@ func PatternMatches(pattern MountPointPattern, mount *MountPoint) bool {
 		return false
 	}
 
+	if len(pattern.AnyOf) > 0 {
+		matched := false
+		for _, sub := range pattern.AnyOf {
+			if PatternMatches(sub, mount) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for _, sub := range pattern.AllOf {
+		if !PatternMatches(sub, mount) {
+			return false
+		}
+	}
+
+	if len(pattern.OneOf) > 0 {
+		matches := 0
+		for _, sub := range pattern.OneOf {
+			if PatternMatches(sub, mount) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return false
+		}
+	}
+
+	if pattern.Not != nil && PatternMatches(*pattern.Not, mount) {
+		return false
+	}
+
 	return true
 }
 
+// MatchResult is the outcome of matching an AppliedMiddlewareStackPattern
+// against a stack of applied middleware. Matched reports whether the
+// pattern matched; Bindings maps each named Select slot encountered in
+// the pattern to every concrete AppliedMiddleware that satisfied it, so
+// that downstream middleware-dispatch logic can act on the elements a
+// pattern picked out rather than just the boolean verdict. Bindings is
+// nil if the pattern has no Select names.
+type MatchResult struct {
+	Matched  bool
+	Bindings map[string][]AppliedMiddleware
+}
+
 func appliedMiddlewareStackPatternMatches(pattern AppliedMiddlewareStackPattern, appliedMiddleware []AppliedMiddleware) bool {
+	result, err := AppliedMiddlewareStackPatternMatch(pattern, appliedMiddleware)
+	return err == nil && result.Matched
+}
 
-	if !middlewareExist(pattern.Exists, appliedMiddleware, false) {
-		return false
+// AppliedMiddlewareStackPatternMatch is the binding-aware counterpart of
+// appliedMiddlewareStackPatternMatches. A match arising from a negative
+// clause (NotExists, NotAll, NotAnySequence, ...) never contributes
+// bindings, since that clause matching means the selected element was
+// absent from the stack, not present.
+//
+// The returned error is non-nil only when the pattern itself cannot be
+// evaluated -- currently, when DependsOn describes a dependency cycle
+// that no ordering of a middleware stack could ever satisfy -- as
+// opposed to simply not matching the given stack.
+func AppliedMiddlewareStackPatternMatch(pattern AppliedMiddlewareStackPattern, appliedMiddleware []AppliedMiddleware) (MatchResult, error) {
+	if err := dependsOnCycleCheck(pattern.DependsOn); err != nil {
+		return MatchResult{}, err
 	}
-	if !middlewareExist(pattern.NotExists, appliedMiddleware, true) {
-		return false
+
+	var bindings map[string][]AppliedMiddleware
+
+	matched, b := middlewareExistMatch(pattern.Exists, appliedMiddleware, false)
+	if !matched {
+		return MatchResult{}, nil
+	}
+	bindings = mergeBindings(bindings, b)
+	if matched, _ = middlewareExistMatch(pattern.NotExists, appliedMiddleware, true); !matched {
+		return MatchResult{}, nil
 	}
 
-	if !middlewareAll(pattern.All, appliedMiddleware, false) {
-		return false
+	if matched, b = middlewareAllMatch(pattern.All, appliedMiddleware, false); !matched {
+		return MatchResult{}, nil
 	}
-	if !middlewareAll(pattern.NotAll, appliedMiddleware, true) {
-		return false
+	bindings = mergeBindings(bindings, b)
+	if matched, _ = middlewareAllMatch(pattern.NotAll, appliedMiddleware, true); !matched {
+		return MatchResult{}, nil
 	}
 
-	if !middlewareAnySequence(pattern.AnySequence, appliedMiddleware, false) {
-		return false
+	if matched, b = middlewareAnySequenceMatch(pattern.AnySequence, appliedMiddleware, false); !matched {
+		return MatchResult{}, nil
 	}
-	if !middlewareAnySequence(pattern.NotAnySequence, appliedMiddleware, true) {
-		return false
+	bindings = mergeBindings(bindings, b)
+	if matched, _ = middlewareAnySequenceMatch(pattern.NotAnySequence, appliedMiddleware, true); !matched {
+		return MatchResult{}, nil
 	}
 
-	if !middlewareTopSequence(pattern.TopSequence, appliedMiddleware, false) {
-		return false
+	if matched, b = middlewareTopSequenceMatch(pattern.TopSequence, appliedMiddleware, false); !matched {
+		return MatchResult{}, nil
 	}
-	if !middlewareTopSequence(pattern.NotTopSequence, appliedMiddleware, true) {
-		return false
+	bindings = mergeBindings(bindings, b)
+	if matched, _ = middlewareTopSequenceMatch(pattern.NotTopSequence, appliedMiddleware, true); !matched {
+		return MatchResult{}, nil
 	}
 
-	if !middlewareBottomSequence(pattern.BottomSequence, appliedMiddleware, false) {
-		return false
+	if matched, b = middlewareBottomSequenceMatch(pattern.BottomSequence, appliedMiddleware, false); !matched {
+		return MatchResult{}, nil
 	}
-	if !middlewareBottomSequence(pattern.NotBottomSequence, appliedMiddleware, true) {
-		return false
+	bindings = mergeBindings(bindings, b)
+	if matched, _ = middlewareBottomSequenceMatch(pattern.NotBottomSequence, appliedMiddleware, true); !matched {
+		return MatchResult{}, nil
 	}
 
-	if !middlewareRelativeOrder(pattern.RelativeOrder, appliedMiddleware, false) {
-		return false
+	if matched, b = middlewareRelativeOrderMatch(pattern.RelativeOrder, appliedMiddleware, false); !matched {
+		return MatchResult{}, nil
 	}
-	if !middlewareRelativeOrder(pattern.NotRelativeOrder, appliedMiddleware, true) {
-		return false
+	bindings = mergeBindings(bindings, b)
+	if matched, _ = middlewareRelativeOrderMatch(pattern.NotRelativeOrder, appliedMiddleware, true); !matched {
+		return MatchResult{}, nil
+	}
+
+	if !dependsOnMatches(pattern.DependsOn, appliedMiddleware) {
+		return MatchResult{}, nil
+	}
+
+	return MatchResult{Matched: true, Bindings: bindings}, nil
+}
+
+// MatchError reports that an AppliedMiddlewareStackPattern could not be
+// evaluated at all, independent of any particular middleware stack.
+type MatchError struct {
+	Msg string
+}
+
+func (e *MatchError) Error() string { return e.Msg }
+
+// dependsOnMatches checks that every applied middleware matching a
+// dependency's Plugin has, earlier in the stack, an applied middleware
+// matching each of that dependency's Requires patterns.
+func dependsOnMatches(deps []MiddlewareDependency, appliedMiddleware []AppliedMiddleware) bool {
+	for _, dep := range deps {
+		for i, mw := range appliedMiddleware {
+			if !appliedMiddlewarePatternMatches(dep.Plugin, mw) {
+				continue
+			}
+			for _, req := range dep.Requires {
+				if !anyMatches(req, appliedMiddleware[:i]) {
+					return false
+				}
+			}
+		}
 	}
 
 	return true
 }
 
-func middlewareExist(patterns []AppliedMiddlewarePattern, middleware []AppliedMiddleware, not bool) bool {
+func anyMatches(pattern AppliedMiddlewarePattern, appliedMiddleware []AppliedMiddleware) bool {
+	for _, mw := range appliedMiddleware {
+		if appliedMiddlewarePatternMatches(pattern, mw) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dependsOnCycleCheck rejects a DependsOn list whose entries depend on
+// one another in a cycle (by Requires pattern referencing another
+// entry's Plugin pattern): no ordering of a middleware stack could ever
+// satisfy such a pattern, so it's rejected outright via a standard
+// depth-first dependency-graph walk rather than being evaluated per
+// stack.
+func dependsOnCycleCheck(deps []MiddlewareDependency) error {
+	n := len(deps)
+	if n == 0 {
+		return nil
+	}
+
+	// edges[i] holds the indices of entries depended on by entry i.
+	edges := make([][]int, n)
+	for i, dep := range deps {
+		for _, req := range dep.Requires {
+			for j, other := range deps {
+				if reflect.DeepEqual(req, other.Plugin) {
+					edges[i] = append(edges[i], j)
+				}
+			}
+		}
+	}
+
+	const (
+		white = iota
+		gray
+		black
+	)
+	color := make([]int, n)
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		color[i] = gray
+		for _, j := range edges[i] {
+			switch color[j] {
+			case gray:
+				return &MatchError{Msg: "mountpoint: AppliedMiddlewareStackPattern.DependsOn contains a dependency cycle"}
+			case white:
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+		color[i] = black
+		return nil
+	}
+
+	for i := 0; i < n; i++ {
+		if color[i] == white {
+			if err := visit(i); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// mergeBindings accumulates src's named slots into dst, appending
+// rather than overwriting so a select name reused across more than one
+// clause of a stack pattern collects every match.
+func mergeBindings(dst, src map[string][]AppliedMiddleware) map[string][]AppliedMiddleware {
+	if src == nil {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string][]AppliedMiddleware)
+	}
+	for name, middleware := range src {
+		dst[name] = append(dst[name], middleware...)
+	}
+	return dst
+}
+
+// recordBinding appends middleware to bindings under pattern's Select
+// name, if any, allocating bindings on first use. A pattern with no
+// Select name is a no-op.
+func recordBinding(bindings map[string][]AppliedMiddleware, pattern AppliedMiddlewarePattern, middleware AppliedMiddleware) map[string][]AppliedMiddleware {
+	if pattern.Select == "" {
+		return bindings
+	}
+	if bindings == nil {
+		bindings = make(map[string][]AppliedMiddleware)
+	}
+	bindings[pattern.Select] = append(bindings[pattern.Select], middleware)
+	return bindings
+}
+
+func middlewareExistMatch(patterns []AppliedMiddlewarePattern, middleware []AppliedMiddleware, not bool) (bool, map[string][]AppliedMiddleware) {
+	var bindings map[string][]AppliedMiddleware
 	for _, middlewarePattern := range patterns {
 		matched := false
-		for _, middleware := range middleware {
-			if appliedMiddlewarePatternMatches(middlewarePattern, middleware) {
+		for _, mw := range middleware {
+			if appliedMiddlewarePatternMatches(middlewarePattern, mw) {
 				matched = true
+				if !not {
+					bindings = recordBinding(bindings, middlewarePattern, mw)
+				}
 				break
 			}
 		}
 
 		if matched == not {
-			return false
+			return false, nil
 		}
 	}
 
-	return true
+	return true, bindings
 }
 
-func middlewareAll(patterns []AppliedMiddlewarePattern, middleware []AppliedMiddleware, not bool) bool {
+func middlewareAllMatch(patterns []AppliedMiddlewarePattern, middleware []AppliedMiddleware, not bool) (bool, map[string][]AppliedMiddleware) {
+	var bindings map[string][]AppliedMiddleware
 	for _, middlewarePattern := range patterns {
 		matched := true
-		for _, middleware := range middleware {
-			if !appliedMiddlewarePatternMatches(middlewarePattern, middleware) {
+		for _, mw := range middleware {
+			if !appliedMiddlewarePatternMatches(middlewarePattern, mw) {
 				matched = false
 				break
 			}
 		}
 
 		if matched == not {
-			return false
+			return false, nil
+		}
+		if matched && !not {
+			for _, mw := range middleware {
+				bindings = recordBinding(bindings, middlewarePattern, mw)
+			}
 		}
 	}
 
-	return true
+	return true, bindings
 }
 
-func middlewareAnySequence(patterns []AppliedMiddlewarePattern, middleware []AppliedMiddleware, not bool) bool {
-	anySequenceCount := len(patterns)
-	appliedMiddlewareCount := len(middleware)
-	if anySequenceCount > 0 {
-		if anySequenceCount <= appliedMiddlewareCount {
-			found := false
-			for i := 0; i <= (appliedMiddlewareCount - anySequenceCount); i++ {
-				matched := true
-				for j, middlewarePattern := range patterns {
-					if !appliedMiddlewarePatternMatches(middlewarePattern, middleware[i+j]) {
-						matched = false
-						break
-					}
-				}
-				if matched {
-					found = true
-					break
-				}
-			}
-			if found == not {
-				return false
-			}
-		} else if !not {
-			return false
+func middlewareAnySequenceMatch(elements []SequenceElement, middleware []AppliedMiddleware, not bool) (bool, map[string][]AppliedMiddleware) {
+	if len(elements) == 0 {
+		return true, nil
+	}
+
+	found := false
+	var bindings map[string][]AppliedMiddleware
+	for start := 0; start <= len(middleware); start++ {
+		ends := matchSequence(elements, middleware, start, false)
+		if len(ends) == 0 {
+			continue
+		}
+		found = true
+		for _, b := range ends {
+			bindings = b
+			break
 		}
+		break
 	}
 
-	return true
+	if found == not {
+		return false, nil
+	}
+	if not {
+		return true, nil
+	}
+	return true, bindings
 }
 
-func middlewareTopSequence(patterns []AppliedMiddlewarePattern, middleware []AppliedMiddleware, not bool) bool {
-	topSequenceCount := len(patterns)
-	appliedMiddlewareCount := len(middleware)
-	if topSequenceCount > 0 {
-		if topSequenceCount <= appliedMiddlewareCount {
-			matched := true
-			for i, middlewarePattern := range patterns {
-				if !appliedMiddlewarePatternMatches(middlewarePattern, middleware[i]) {
-					matched = false
-					break
-				}
-			}
-			if matched == not {
-				return false
-			}
-		} else if !not {
-			return false
+func middlewareTopSequenceMatch(elements []SequenceElement, middleware []AppliedMiddleware, not bool) (bool, map[string][]AppliedMiddleware) {
+	if len(elements) == 0 {
+		return true, nil
+	}
+
+	ends := matchSequence(elements, middleware, 0, false)
+	found := len(ends) > 0
+	if found == not {
+		return false, nil
+	}
+	if not {
+		return true, nil
+	}
+	for _, b := range ends {
+		return true, b
+	}
+	return true, nil
+}
+
+func middlewareBottomSequenceMatch(elements []SequenceElement, middleware []AppliedMiddleware, not bool) (bool, map[string][]AppliedMiddleware) {
+	if len(elements) == 0 {
+		return true, nil
+	}
+
+	n := len(middleware)
+	found := false
+	var bindings map[string][]AppliedMiddleware
+	for start := 0; start <= n; start++ {
+		if b, ok := matchSequence(elements, middleware, start, false)[n]; ok {
+			found = true
+			bindings = b
+			break
 		}
 	}
 
-	return true
+	if found == not {
+		return false, nil
+	}
+	if not {
+		return true, nil
+	}
+	return true, bindings
 }
 
-func middlewareBottomSequence(patterns []AppliedMiddlewarePattern, middleware []AppliedMiddleware, not bool) bool {
-	bottomSequenceCount := len(patterns)
-	appliedMiddlewareCount := len(middleware)
-	if bottomSequenceCount > 0 {
-		if bottomSequenceCount <= appliedMiddlewareCount {
-			matched := true
-			start := appliedMiddlewareCount - bottomSequenceCount
-			for i, middlewarePattern := range patterns {
-				if !appliedMiddlewarePatternMatches(middlewarePattern, middleware[start+i]) {
-					matched = false
-					break
+func middlewareRelativeOrderMatch(elements []SequenceElement, middleware []AppliedMiddleware, not bool) (bool, map[string][]AppliedMiddleware) {
+	if len(elements) == 0 {
+		return true, nil
+	}
+
+	ends := matchSequence(elements, middleware, 0, true)
+	found := len(ends) > 0
+	if found == not {
+		return false, nil
+	}
+	if not {
+		return true, nil
+	}
+	for _, b := range ends {
+		return true, b
+	}
+	return true, nil
+}
+
+// seqOccurrence is one middleware matched against a SequenceElement,
+// remembering which concrete pattern (the element's Pattern or one of
+// its Alternatives) was responsible, so a Select on that pattern can be
+// bound correctly.
+type seqOccurrence struct {
+	middleware AppliedMiddleware
+	pattern    AppliedMiddlewarePattern
+}
+
+// sequenceElementMatchingPattern reports whether el matches mw via
+// el.Pattern or one of el.Alternatives, and returns whichever pattern
+// actually matched.
+func sequenceElementMatchingPattern(el SequenceElement, mw AppliedMiddleware) (AppliedMiddlewarePattern, bool) {
+	if appliedMiddlewarePatternMatches(el.Pattern, mw) {
+		return el.Pattern, true
+	}
+	for _, alt := range el.Alternatives {
+		if appliedMiddlewarePatternMatches(alt, mw) {
+			return alt, true
+		}
+	}
+	return AppliedMiddlewarePattern{}, false
+}
+
+// matchSequence computes every input position reachable by matching
+// elements, in order, against middleware starting at pos, paired with
+// the Select bindings accumulated along whichever path reached that
+// position. Without allowGaps (AnySequence, TopSequence,
+// BottomSequence) each element must match the very next middleware;
+// with it (RelativeOrder) an element may skip over non-matching
+// middleware to find its match. This is the same state-reachability
+// computation a simulated Thompson-constructed NFA would perform for
+// the element list's quantifiers, phrased directly over slice indices
+// since the alphabet here (a handful of sequence elements) is tiny.
+func matchSequence(elements []SequenceElement, middleware []AppliedMiddleware, pos int, allowGaps bool) map[int]map[string][]AppliedMiddleware {
+	if len(elements) == 0 {
+		return map[int]map[string][]AppliedMiddleware{pos: nil}
+	}
+
+	el := elements[0]
+	rest := elements[1:]
+
+	occurrencesFrom := func(from int) map[int]seqOccurrence {
+		found := map[int]seqOccurrence{}
+		if allowGaps {
+			for i := from; i < len(middleware); i++ {
+				if pattern, ok := sequenceElementMatchingPattern(el, middleware[i]); ok {
+					found[i+1] = seqOccurrence{middleware: middleware[i], pattern: pattern}
 				}
 			}
-			if matched == not {
-				return false
+		} else if from < len(middleware) {
+			if pattern, ok := sequenceElementMatchingPattern(el, middleware[from]); ok {
+				found[from+1] = seqOccurrence{middleware: middleware[from], pattern: pattern}
 			}
-		} else if !not {
-			return false
 		}
+		return found
 	}
 
-	return true
-}
-
-func middlewareRelativeOrder(patterns []AppliedMiddlewarePattern, middleware []AppliedMiddleware, not bool) bool {
-	relativeOrderCount := len(patterns)
-	appliedMiddlewareCount := len(middleware)
-	if relativeOrderCount > 0 {
-		if relativeOrderCount <= appliedMiddlewareCount {
-			remainingPatterns := patterns
-			for _, middleware := range middleware {
-				if len(remainingPatterns) == 0 {
-					break
-				}
+	// reached maps every position obtainable after el has consumed as
+	// many (or as few) occurrences as its Quantifier allows, to the
+	// bindings accumulated getting there.
+	reached := map[int]map[string][]AppliedMiddleware{}
 
-				if appliedMiddlewarePatternMatches(remainingPatterns[0], middleware) {
-					remainingPatterns = remainingPatterns[1:]
+	switch el.Quantifier {
+	case ZeroOrOne:
+		reached[pos] = nil
+		for next, occ := range occurrencesFrom(pos) {
+			reached[next] = recordBinding(nil, occ.pattern, occ.middleware)
+		}
+	case ZeroOrMore, OneOrMore:
+		visited := map[int]map[string][]AppliedMiddleware{pos: nil}
+		queue := []int{pos}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			for next, occ := range occurrencesFrom(cur) {
+				bindings := mergeBindings(cloneBindings(visited[cur]), recordBinding(nil, occ.pattern, occ.middleware))
+				if _, ok := visited[next]; !ok {
+					visited[next] = bindings
+					queue = append(queue, next)
 				}
 			}
-			if (len(remainingPatterns) == 0) == not {
-				return false
+		}
+		for p, b := range visited {
+			if p == pos && el.Quantifier == OneOrMore {
+				continue
 			}
-		} else if !not {
-			return false
+			reached[p] = b
+		}
+	default: // One
+		for next, occ := range occurrencesFrom(pos) {
+			reached[next] = recordBinding(nil, occ.pattern, occ.middleware)
 		}
 	}
 
-	return true
+	results := map[int]map[string][]AppliedMiddleware{}
+	for p, b := range reached {
+		for end, tailBindings := range matchSequence(rest, middleware, p, allowGaps) {
+			merged := mergeBindings(cloneBindings(b), tailBindings)
+			if existing, ok := results[end]; ok {
+				merged = mergeBindings(cloneBindings(existing), merged)
+			}
+			results[end] = merged
+		}
+	}
+	return results
+}
+
+// cloneBindings returns a deep-enough copy of b (copying the outer map
+// and the inner slices) so that matchSequence's concurrent exploration
+// of several candidate paths never lets one path's accumulation
+// clobber another's.
+func cloneBindings(b map[string][]AppliedMiddleware) map[string][]AppliedMiddleware {
+	if b == nil {
+		return nil
+	}
+	clone := make(map[string][]AppliedMiddleware, len(b))
+	for name, middleware := range b {
+		clone[name] = append([]AppliedMiddleware(nil), middleware...)
+	}
+	return clone
 }
 
 func appliedMiddlewarePatternMatches(pattern AppliedMiddlewarePattern, appliedMiddleware AppliedMiddleware) bool {
@@ -350,47 +688,183 @@ func stringMapPatternMatches(pattern StringMapPattern, stringMap map[string]stri
 	return true
 }
 
+// stringPatternMatches reports whether every matcher field set on
+// pattern matches string -- an implicit AND across fields -- with Not
+// inverting that conjunction as a whole, not each field independently
+// (so a pattern combining two fields with Not: true matches whenever
+// NOT ALL of them match, rather than requiring each one to individually
+// mismatch).
 func stringPatternMatches(pattern StringPattern, string string) bool {
-	if pattern.Empty && (len(string) == 0) == pattern.Not {
-		return false
+	matched := true
+
+	if pattern.Empty {
+		matched = matched && len(string) == 0
 	}
 
-	if pattern.Prefix != "" && strings.HasPrefix(string, pattern.Prefix) == pattern.Not {
-		return false
+	if pattern.Prefix != "" {
+		matched = matched && strings.HasPrefix(string, pattern.Prefix)
 	}
 
 	if pattern.PathPrefix != "" {
-		cleanPath := filepath.Clean(string)
-		cleanPattern := filepath.Clean(pattern.PathPrefix)
+		cleanPath := cleanPathCached(string)
+		cleanPattern := cleanPathCached(pattern.PathPrefix)
 		patternLen := len(cleanPattern)
 
-		matched := strings.HasPrefix(cleanPath, cleanPattern)
-		if matched && cleanPattern[patternLen-1] != '/' {
+		pathMatched := strings.HasPrefix(cleanPath, cleanPattern)
+		if pathMatched && cleanPattern[patternLen-1] != '/' {
 			if len(cleanPath) > patternLen && cleanPath[patternLen] != '/' {
-				matched = false
+				pathMatched = false
 			}
 		}
+		matched = matched && pathMatched
+	}
 
-		if matched == pattern.Not {
-			return false
-		}
+	if pattern.Suffix != "" {
+		matched = matched && strings.HasSuffix(string, pattern.Suffix)
 	}
 
-	if pattern.Suffix != "" && strings.HasSuffix(string, pattern.Suffix) == pattern.Not {
-		return false
+	if pattern.Exactly != "" {
+		matched = matched && pattern.Exactly == string
 	}
 
-	if pattern.Exactly != "" && (pattern.Exactly == string) == pattern.Not {
-		return false
+	if pattern.Contains != "" {
+		matched = matched && strings.Contains(string, pattern.Contains)
 	}
 
-	if pattern.Contains != "" && strings.Contains(string, pattern.Contains) == pattern.Not {
-		return false
+	if pattern.Regex != "" {
+		re, err := compiledRegex(pattern.Regex)
+		matched = matched && err == nil && re.MatchString(string)
 	}
 
-	return true
+	if pattern.Glob != "" {
+		re, err := compiledGlob(pattern.Glob)
+		matched = matched && err == nil && re.MatchString(string)
+	}
+
+	return matched != pattern.Not
 }
 
 func stringPatternIsEmpty(p StringPattern) bool {
-	return !p.Empty && p.Prefix == "" && p.PathPrefix == "" && p.Suffix == "" && p.Exactly == "" && p.Contains == ""
+	return !p.Empty && p.Prefix == "" && p.PathPrefix == "" && p.Suffix == "" && p.Exactly == "" && p.Contains == "" && p.Regex == "" && p.Glob == ""
+}
+
+// cleanPathCache holds filepath.Clean results keyed by their input, so
+// that repeatedly matching the same PathPrefix pattern (or the same
+// mount path) across many mount requests only pays the Clean cost once.
+var cleanPathCache sync.Map // map[string]string
+
+func cleanPathCached(path string) string {
+	if cached, ok := cleanPathCache.Load(path); ok {
+		return cached.(string)
+	}
+	clean := filepath.Clean(path)
+	cleanPathCache.Store(path, clean)
+	return clean
+}
+
+// patternCache holds compiled regular expressions keyed by their source
+// pattern string (the StringPattern.Regex or StringPattern.Glob, the
+// latter after translation to a regex). Patterns are evaluated
+// repeatedly per mount request, so this avoids repaying the compile
+// cost on every hot-path call.
+var patternCache sync.Map // map[string]*regexp.Regexp
+
+// compiledRegex compiles pattern full-string anchored and with dot
+// matching newlines, mirroring the approach Prometheus's
+// FastRegexMatcher takes for label matching, and caches the result.
+func compiledRegex(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := patternCache.Load("regex:" + pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile("^(?s:" + pattern + ")$")
+	if err != nil {
+		return nil, err
+	}
+
+	patternCache.Store("regex:"+pattern, re)
+	return re, nil
+}
+
+// compiledGlob translates a glob pattern ("*", "?", "**" and "[...]",
+// evaluated against the string as a path) to an anchored regular
+// expression and caches the result.
+func compiledGlob(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := patternCache.Load("glob:" + pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile("^(?s:" + globToRegexString(pattern) + ")$")
+	if err != nil {
+		return nil, err
+	}
+
+	patternCache.Store("glob:"+pattern, re)
+	return re, nil
+}
+
+// globToRegexString translates a build-system-style path glob into the
+// body of a regular expression: "**" matches any number of path
+// segments, "*" matches within a single path segment, "?" matches a
+// single non-separator character, and "[...]" character classes pass
+// through to the regex engine unchanged.
+func globToRegexString(glob string) string {
+	var b bytes.Buffer
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			j := i + 1
+			for j < len(runes) && runes[j] != ']' {
+				j++
+			}
+			if j < len(runes) {
+				b.WriteString(string(runes[i : j+1]))
+				i = j
+			} else {
+				b.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return b.String()
+}
+
+// ValidateStringPattern rejects a StringPattern whose Regex or Glob
+// field fails to compile, so plugin registration can surface a
+// malformed pattern immediately rather than at the first mount request
+// that reaches it.
+//
+// A StringPattern may set more than one of its matcher fields (Empty,
+// Prefix, PathPrefix, Suffix, Exactly, Contains, Regex, Glob) at once --
+// stringPatternMatches requires every field that's set to match
+// (conjunction), with Not applied to the conjunction as a whole rather
+// than to each field's comparison individually. This lets one
+// StringPattern express e.g. "has PathPrefix /var/lib and matches Regex
+// /var/lib/com\.acme\.encrypt/.*" without a separate round trip per
+// condition. Regex (like Glob) is matched full-string, so a Regex
+// combined with other fields must still describe the whole string
+// rather than just the portion those other fields don't already cover.
+func ValidateStringPattern(pattern StringPattern) error {
+	if pattern.Regex != "" {
+		if _, err := compiledRegex(pattern.Regex); err != nil {
+			return fmt.Errorf("invalid regex pattern %q: %s", pattern.Regex, err)
+		}
+	}
+	if pattern.Glob != "" {
+		if _, err := compiledGlob(pattern.Glob); err != nil {
+			return fmt.Errorf("invalid glob pattern %q: %s", pattern.Glob, err)
+		}
+	}
+	return nil
 }
@@ -86,6 +86,43 @@ func TestStringPatternContains(t *testing.T) {
 		})
 }
 
+func TestStringPatternRegex(t *testing.T) {
+	testStringPatternInverse(StringPattern{Regex: "a.c"},
+		func(pattern StringPattern, tru, fals bool) {
+			require.Equal(t, fals, stringPatternMatches(pattern, ""))
+			require.Equal(t, fals, stringPatternMatches(pattern, "abcd"))
+			require.Equal(t, tru, stringPatternMatches(pattern, "abc"))
+			require.Equal(t, tru, stringPatternMatches(pattern, "a\nc"))
+		})
+
+	require.Nil(t, ValidateStringPattern(StringPattern{Regex: "a.c"}))
+	require.Error(t, ValidateStringPattern(StringPattern{Regex: "a(c"}))
+}
+
+func TestStringPatternGlob(t *testing.T) {
+	testStringPatternInverse(StringPattern{Glob: "/data/*/config.json"},
+		func(pattern StringPattern, tru, fals bool) {
+			require.Equal(t, fals, stringPatternMatches(pattern, "/data/config.json"))
+			require.Equal(t, tru, stringPatternMatches(pattern, "/data/app/config.json"))
+			require.Equal(t, fals, stringPatternMatches(pattern, "/data/app/sub/config.json"))
+		})
+
+	testStringPatternInverse(StringPattern{Glob: "/data/**/config.json"},
+		func(pattern StringPattern, tru, fals bool) {
+			require.Equal(t, fals, stringPatternMatches(pattern, "/data/config.json"))
+			require.Equal(t, tru, stringPatternMatches(pattern, "/data/app/sub/config.json"))
+			require.Equal(t, fals, stringPatternMatches(pattern, "/data/app/sub/config.yaml"))
+		})
+
+	testStringPatternInverse(StringPattern{Glob: "/data/[abc].json"},
+		func(pattern StringPattern, tru, fals bool) {
+			require.Equal(t, tru, stringPatternMatches(pattern, "/data/a.json"))
+			require.Equal(t, fals, stringPatternMatches(pattern, "/data/d.json"))
+		})
+
+	require.Nil(t, ValidateStringPattern(StringPattern{Glob: "/data/*.json"}))
+}
+
 func testStringMapPatternInverse(pattern StringMapPattern, f func(pattern StringMapPattern, tru, fals bool)) {
 	f(pattern, true, false)
 	pattern.Not = true
@@ -404,13 +441,13 @@ func testAppliedMiddlewareStackPatternInverse(pattern AppliedMiddlewareStackPatt
 	pattern.NotAll = pattern.All
 	pattern.All = []AppliedMiddlewarePattern{}
 	pattern.NotAnySequence = pattern.AnySequence
-	pattern.AnySequence = []AppliedMiddlewarePattern{}
+	pattern.AnySequence = []SequenceElement{}
 	pattern.NotTopSequence = pattern.TopSequence
-	pattern.TopSequence = []AppliedMiddlewarePattern{}
+	pattern.TopSequence = []SequenceElement{}
 	pattern.NotBottomSequence = pattern.BottomSequence
-	pattern.BottomSequence = []AppliedMiddlewarePattern{}
+	pattern.BottomSequence = []SequenceElement{}
 	pattern.NotRelativeOrder = pattern.RelativeOrder
-	pattern.RelativeOrder = []AppliedMiddlewarePattern{}
+	pattern.RelativeOrder = []SequenceElement{}
 	f(pattern, false, true)
 }
 
@@ -505,9 +542,9 @@ func TestAppliedMiddlewareStackPatternAll(t *testing.T) {
 
 func TestAppliedMiddlewareStackPatternAnySequence(t *testing.T) {
 	testAppliedMiddlewareStackPatternInverse(AppliedMiddlewareStackPattern{
-		AnySequence: []AppliedMiddlewarePattern{
-			{Name: []StringPattern{{Exactly: "plugin:plugin1"}}},
-			{Name: []StringPattern{{Exactly: "plugin:plugin2"}}},
+		AnySequence: []SequenceElement{
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:plugin1"}}}},
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:plugin2"}}}},
 		},
 	}, func(pattern AppliedMiddlewareStackPattern, tru, fals bool) {
 		list := []AppliedMiddleware{}
@@ -557,9 +594,9 @@ func TestAppliedMiddlewareStackPatternAnySequence(t *testing.T) {
 
 func TestAppliedMiddlewareStackPatternTopSequence(t *testing.T) {
 	testAppliedMiddlewareStackPatternInverse(AppliedMiddlewareStackPattern{
-		TopSequence: []AppliedMiddlewarePattern{
-			{Name: []StringPattern{{Exactly: "plugin:plugin1"}}},
-			{Name: []StringPattern{{Exactly: "plugin:plugin2"}}},
+		TopSequence: []SequenceElement{
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:plugin1"}}}},
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:plugin2"}}}},
 		},
 	}, func(pattern AppliedMiddlewareStackPattern, tru, fals bool) {
 		list := []AppliedMiddleware{}
@@ -596,9 +633,9 @@ func TestAppliedMiddlewareStackPatternTopSequence(t *testing.T) {
 
 func TestAppliedMiddlewareStackPatternBottomSequence(t *testing.T) {
 	testAppliedMiddlewareStackPatternInverse(AppliedMiddlewareStackPattern{
-		BottomSequence: []AppliedMiddlewarePattern{
-			{Name: []StringPattern{{Exactly: "plugin:plugin1"}}},
-			{Name: []StringPattern{{Exactly: "plugin:plugin2"}}},
+		BottomSequence: []SequenceElement{
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:plugin1"}}}},
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:plugin2"}}}},
 		},
 	}, func(pattern AppliedMiddlewareStackPattern, tru, fals bool) {
 		list := []AppliedMiddleware{}
@@ -635,9 +672,9 @@ func TestAppliedMiddlewareStackPatternBottomSequence(t *testing.T) {
 
 func TestAppliedMiddlewareStackPatternRelativeOrder(t *testing.T) {
 	testAppliedMiddlewareStackPatternInverse(AppliedMiddlewareStackPattern{
-		RelativeOrder: []AppliedMiddlewarePattern{
-			{Name: []StringPattern{{Exactly: "plugin:plugin1"}}},
-			{Name: []StringPattern{{Exactly: "plugin:plugin2"}}},
+		RelativeOrder: []SequenceElement{
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:plugin1"}}}},
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:plugin2"}}}},
 		},
 	}, func(pattern AppliedMiddlewareStackPattern, tru, fals bool) {
 		list := []AppliedMiddleware{}
@@ -878,4 +915,366 @@ func TestPattern(t *testing.T) {
 		Scope: &globalScope,
 	}
 	require.Equal(t, false, PatternMatches(pattern, mountpoint))
+
+	pattern = MountPointPattern{
+		Source: []StringPattern{{Regex: "/[a-z]+"}},
+	}
+	require.Equal(t, true, PatternMatches(pattern, mountpoint))
+	pattern = MountPointPattern{
+		Source: []StringPattern{{Not: true, Regex: "/[a-z]+"}},
+	}
+	require.Equal(t, false, PatternMatches(pattern, mountpoint))
+	pattern = MountPointPattern{
+		Destination: []StringPattern{{Glob: "/mnt/*"}},
+	}
+	require.Equal(t, true, PatternMatches(pattern, mountpoint))
+	pattern = MountPointPattern{
+		Destination: []StringPattern{{Glob: "/mnt/**/deep"}},
+	}
+	require.Equal(t, false, PatternMatches(pattern, mountpoint))
+}
+
+// TestPatternBooleanComposition covers AnyOf/AllOf/OneOf/Not on top of
+// the existing per-field implicit-AND pattern, and their interaction
+// with the per-field Not on StringPattern.
+func TestPatternBooleanComposition(t *testing.T) {
+	bindMount := &MountPoint{Type: TypeBind, Destination: "/etc/app"}
+	backupVolume := &MountPoint{Type: TypeVolume, Name: "backup-2024"}
+	otherVolume := &MountPoint{Type: TypeVolume, Name: "data"}
+
+	tVolume := TypeVolume
+	tBind := TypeBind
+
+	// either a bind mount under /etc OR a volume named backup*
+	pattern := MountPointPattern{
+		AnyOf: []MountPointPattern{
+			{Type: &tBind, Destination: []StringPattern{{PathPrefix: "/etc"}}},
+			{Type: &tVolume, Name: []StringPattern{{Prefix: "backup"}}},
+		},
+	}
+	require.Equal(t, true, PatternMatches(pattern, bindMount))
+	require.Equal(t, true, PatternMatches(pattern, backupVolume))
+	require.Equal(t, false, PatternMatches(pattern, otherVolume))
+
+	// AllOf: every sub-pattern must match
+	pattern = MountPointPattern{
+		AllOf: []MountPointPattern{
+			{Type: &tVolume},
+			{Name: []StringPattern{{Prefix: "backup"}}},
+		},
+	}
+	require.Equal(t, true, PatternMatches(pattern, backupVolume))
+	require.Equal(t, false, PatternMatches(pattern, otherVolume))
+	require.Equal(t, false, PatternMatches(pattern, bindMount))
+
+	// OneOf: exactly one sub-pattern must match, not zero or both
+	pattern = MountPointPattern{
+		OneOf: []MountPointPattern{
+			{Type: &tVolume},
+			{Name: []StringPattern{{Prefix: "backup"}}},
+		},
+	}
+	require.Equal(t, false, PatternMatches(pattern, backupVolume)) // matches both sub-patterns
+	require.Equal(t, true, PatternMatches(pattern, otherVolume))   // matches only the Type sub-pattern
+	require.Equal(t, false, PatternMatches(pattern, bindMount))    // matches neither
+
+	// Not negates a whole sub-pattern, distinct from per-field Not
+	pattern = MountPointPattern{
+		Not: &MountPointPattern{Type: &tVolume},
+	}
+	require.Equal(t, true, PatternMatches(pattern, bindMount))
+	require.Equal(t, false, PatternMatches(pattern, backupVolume))
+
+	// nesting: AnyOf containing a Not
+	pattern = MountPointPattern{
+		AnyOf: []MountPointPattern{
+			{Not: &MountPointPattern{Type: &tVolume}},
+			{Name: []StringPattern{{Prefix: "backup"}}},
+		},
+	}
+	require.Equal(t, true, PatternMatches(pattern, bindMount))
+	require.Equal(t, true, PatternMatches(pattern, backupVolume))
+	require.Equal(t, false, PatternMatches(pattern, otherVolume))
+}
+
+// TestValidateStringPatternCombinesMatcherFields covers the conjunction
+// precedence for a StringPattern that sets more than one matcher field:
+// ValidateStringPattern only rejects a bad Regex/Glob, and
+// stringPatternMatches requires every set field to match.
+func TestValidateStringPatternCombinesMatcherFields(t *testing.T) {
+	require.Nil(t, ValidateStringPattern(StringPattern{Exactly: "/src"}))
+	require.Nil(t, ValidateStringPattern(StringPattern{Regex: "/[a-z]+"}))
+	require.Nil(t, ValidateStringPattern(StringPattern{}))
+	require.Nil(t, ValidateStringPattern(StringPattern{PathPrefix: "/var/lib", Regex: `/var/lib/com\.acme\.encrypt/.*`}))
+
+	require.Error(t, ValidateStringPattern(StringPattern{Regex: "/[a-z"}))
+	require.Error(t, ValidateStringPattern(StringPattern{Glob: "[z-a]"}))
+
+	// Regex is matched full-string (compiledRegex anchors it
+	// "^(?s:...)$"), so a combined pattern's Regex field must itself
+	// describe the whole string, not a substring within it.
+	pattern := StringPattern{PathPrefix: "/var/lib", Regex: `/var/lib/com\.acme\.encrypt/.*`}
+	require.Equal(t, true, stringPatternMatches(pattern, "/var/lib/com.acme.encrypt/db"))
+	require.Equal(t, false, stringPatternMatches(pattern, "/var/lib/other"))
+	require.Equal(t, false, stringPatternMatches(pattern, "/tmp/com.acme.encrypt/db"))
+}
+
+// TestStringPatternMatchesNotInvertsWholeConjunctionNotEachField covers
+// a StringPattern that combines two matcher fields with Not: true. Not
+// negates the AND of Prefix and Suffix as a whole, so a string matching
+// only one of the two fields must still match the Not pattern -- it is
+// NOT the case that both matched.
+func TestStringPatternMatchesNotInvertsWholeConjunctionNotEachField(t *testing.T) {
+	pattern := StringPattern{Not: true, Prefix: "a", Suffix: "b"}
+
+	require.Equal(t, false, stringPatternMatches(pattern, "axb"), "both Prefix and Suffix match, so the (negated) conjunction must not match")
+	require.Equal(t, true, stringPatternMatches(pattern, "ayz"), "only Prefix matches, so the conjunction is false and Not makes it match")
+	require.Equal(t, true, stringPatternMatches(pattern, "xyb"), "only Suffix matches, so the conjunction is false and Not makes it match")
+	require.Equal(t, true, stringPatternMatches(pattern, "xyz"), "neither matches, so the conjunction is false and Not makes it match")
+}
+
+func TestAppliedMiddlewareStackPatternMatchSelect(t *testing.T) {
+	plugin0 := AppliedMiddleware{Name: "plugin:plugin0"}
+	plugin1 := AppliedMiddleware{Name: "plugin:plugin1"}
+	plugin2 := AppliedMiddleware{Name: "plugin:plugin2"}
+
+	pattern := AppliedMiddlewareStackPattern{
+		Exists: []AppliedMiddlewarePattern{
+			{Name: []StringPattern{{Exactly: "plugin:plugin0"}}, Select: "first"},
+		},
+	}
+	result, err := AppliedMiddlewareStackPatternMatch(pattern, []AppliedMiddleware{plugin0, plugin1})
+	require.Nil(t, err)
+	require.Equal(t, true, result.Matched)
+	require.Equal(t, []AppliedMiddleware{plugin0}, result.Bindings["first"])
+
+	result, err = AppliedMiddlewareStackPatternMatch(pattern, []AppliedMiddleware{plugin1})
+	require.Nil(t, err)
+	require.Equal(t, false, result.Matched)
+	require.Nil(t, result.Bindings)
+
+	// NotExists matching (the named element is absent) must not bind
+	// anything, since there is no concrete middleware to point at.
+	pattern = AppliedMiddlewareStackPattern{
+		NotExists: []AppliedMiddlewarePattern{
+			{Name: []StringPattern{{Exactly: "plugin:plugin0"}}, Select: "absent"},
+		},
+	}
+	result, err = AppliedMiddlewareStackPatternMatch(pattern, []AppliedMiddleware{plugin1})
+	require.Nil(t, err)
+	require.Equal(t, true, result.Matched)
+	require.Nil(t, result.Bindings)
+
+	// TopSequence binds every position in the sequence under its own
+	// select name, and two select names in the same pattern both
+	// surface in Bindings.
+	pattern = AppliedMiddlewareStackPattern{
+		TopSequence: []SequenceElement{
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:plugin0"}}, Select: "head"}},
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:plugin1"}}, Select: "second"}},
+		},
+	}
+	result, err = AppliedMiddlewareStackPatternMatch(pattern, []AppliedMiddleware{plugin0, plugin1, plugin2})
+	require.Nil(t, err)
+	require.Equal(t, true, result.Matched)
+	require.Equal(t, []AppliedMiddleware{plugin0}, result.Bindings["head"])
+	require.Equal(t, []AppliedMiddleware{plugin1}, result.Bindings["second"])
+
+	// Overlapping selections: the same select name used by more than
+	// one clause accumulates every match it is responsible for.
+	pattern = AppliedMiddlewareStackPattern{
+		Exists: []AppliedMiddlewarePattern{
+			{Name: []StringPattern{{Exactly: "plugin:plugin0"}}, Select: "any"},
+			{Name: []StringPattern{{Exactly: "plugin:plugin2"}}, Select: "any"},
+		},
+	}
+	result, err = AppliedMiddlewareStackPatternMatch(pattern, []AppliedMiddleware{plugin0, plugin1, plugin2})
+	require.Nil(t, err)
+	require.Equal(t, true, result.Matched)
+	require.ElementsMatch(t, []AppliedMiddleware{plugin0, plugin2}, result.Bindings["any"])
+}
+
+func TestAppliedMiddlewareStackPatternDependsOn(t *testing.T) {
+	audit := AppliedMiddleware{Name: "plugin:audit"}
+	encryption := AppliedMiddleware{Name: "plugin:encryption"}
+
+	auditPattern := AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:audit"}}}
+	encryptionPattern := AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:encryption"}}}
+
+	pattern := AppliedMiddlewareStackPattern{
+		DependsOn: []MiddlewareDependency{
+			{Plugin: encryptionPattern, Requires: []AppliedMiddlewarePattern{auditPattern}},
+		},
+	}
+
+	result, err := AppliedMiddlewareStackPatternMatch(pattern, []AppliedMiddleware{audit, encryption})
+	require.Nil(t, err)
+	require.Equal(t, true, result.Matched)
+
+	// encryption with no audit anywhere before it fails the dependency
+	result, err = AppliedMiddlewareStackPatternMatch(pattern, []AppliedMiddleware{encryption})
+	require.Nil(t, err)
+	require.Equal(t, false, result.Matched)
+
+	// encryption before audit doesn't satisfy "earlier in the stack"
+	result, err = AppliedMiddlewareStackPatternMatch(pattern, []AppliedMiddleware{encryption, audit})
+	require.Nil(t, err)
+	require.Equal(t, false, result.Matched)
+
+	// a stack with no encryption middleware at all trivially satisfies
+	// the dependency -- there's nothing to require anything of
+	result, err = AppliedMiddlewareStackPatternMatch(pattern, []AppliedMiddleware{audit})
+	require.Nil(t, err)
+	require.Equal(t, true, result.Matched)
+}
+
+func TestAppliedMiddlewareStackPatternDependsOnCycle(t *testing.T) {
+	auditPattern := AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:audit"}}}
+	encryptionPattern := AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:encryption"}}}
+
+	pattern := AppliedMiddlewareStackPattern{
+		DependsOn: []MiddlewareDependency{
+			{Plugin: encryptionPattern, Requires: []AppliedMiddlewarePattern{auditPattern}},
+			{Plugin: auditPattern, Requires: []AppliedMiddlewarePattern{encryptionPattern}},
+		},
+	}
+
+	result, err := AppliedMiddlewareStackPatternMatch(pattern, []AppliedMiddleware{
+		{Name: "plugin:audit"}, {Name: "plugin:encryption"},
+	})
+	require.Error(t, err)
+	require.IsType(t, &MatchError{}, err)
+	require.Equal(t, MatchResult{}, result)
+}
+
+// auditTransformLoggingPattern returns a TopSequence of: audit, then
+// optionally encryption, then one-or-more transform plugins, then
+// logging -- the scenario the Quantifier feature was added for.
+func auditTransformLoggingPattern() AppliedMiddlewareStackPattern {
+	return AppliedMiddlewareStackPattern{
+		TopSequence: []SequenceElement{
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:audit"}}}},
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:encryption"}}}, Quantifier: ZeroOrOne},
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:transform"}}}, Quantifier: OneOrMore},
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:logging"}}}},
+		},
+	}
+}
+
+func TestAppliedMiddlewareStackPatternSequenceZeroOrOne(t *testing.T) {
+	pattern := auditTransformLoggingPattern()
+
+	// encryption present
+	require.Equal(t, true, appliedMiddlewareStackPatternMatches(pattern, []AppliedMiddleware{
+		{Name: "plugin:audit"}, {Name: "plugin:encryption"}, {Name: "plugin:transform"}, {Name: "plugin:logging"},
+	}))
+
+	// encryption absent -- ZeroOrOne still matches
+	require.Equal(t, true, appliedMiddlewareStackPatternMatches(pattern, []AppliedMiddleware{
+		{Name: "plugin:audit"}, {Name: "plugin:transform"}, {Name: "plugin:logging"},
+	}))
+
+	// encryption repeated -- ZeroOrOne allows at most one
+	require.Equal(t, false, appliedMiddlewareStackPatternMatches(pattern, []AppliedMiddleware{
+		{Name: "plugin:audit"}, {Name: "plugin:encryption"}, {Name: "plugin:encryption"}, {Name: "plugin:transform"}, {Name: "plugin:logging"},
+	}))
+}
+
+func TestAppliedMiddlewareStackPatternSequenceOneOrMore(t *testing.T) {
+	pattern := auditTransformLoggingPattern()
+
+	// a single transform satisfies OneOrMore
+	require.Equal(t, true, appliedMiddlewareStackPatternMatches(pattern, []AppliedMiddleware{
+		{Name: "plugin:audit"}, {Name: "plugin:transform"}, {Name: "plugin:logging"},
+	}))
+
+	// several consecutive transforms also satisfy OneOrMore
+	require.Equal(t, true, appliedMiddlewareStackPatternMatches(pattern, []AppliedMiddleware{
+		{Name: "plugin:audit"}, {Name: "plugin:transform"}, {Name: "plugin:transform"}, {Name: "plugin:transform"}, {Name: "plugin:logging"},
+	}))
+
+	// zero transforms fails OneOrMore
+	require.Equal(t, false, appliedMiddlewareStackPatternMatches(pattern, []AppliedMiddleware{
+		{Name: "plugin:audit"}, {Name: "plugin:logging"},
+	}))
+}
+
+func TestAppliedMiddlewareStackPatternSequenceZeroOrMore(t *testing.T) {
+	pattern := AppliedMiddlewareStackPattern{
+		TopSequence: []SequenceElement{
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:audit"}}}},
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:transform"}}}, Quantifier: ZeroOrMore},
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:logging"}}}},
+		},
+	}
+
+	// zero transforms is fine with ZeroOrMore
+	require.Equal(t, true, appliedMiddlewareStackPatternMatches(pattern, []AppliedMiddleware{
+		{Name: "plugin:audit"}, {Name: "plugin:logging"},
+	}))
+
+	// several transforms is also fine
+	require.Equal(t, true, appliedMiddlewareStackPatternMatches(pattern, []AppliedMiddleware{
+		{Name: "plugin:audit"}, {Name: "plugin:transform"}, {Name: "plugin:transform"}, {Name: "plugin:logging"},
+	}))
+}
+
+func TestAppliedMiddlewareStackPatternSequenceAlternatives(t *testing.T) {
+	pattern := AppliedMiddlewareStackPattern{
+		TopSequence: []SequenceElement{
+			{
+				Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:gzip"}}},
+				Alternatives: []AppliedMiddlewarePattern{
+					{Name: []StringPattern{{Exactly: "plugin:lz4"}}},
+				},
+			},
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:logging"}}}},
+		},
+	}
+
+	require.Equal(t, true, appliedMiddlewareStackPatternMatches(pattern, []AppliedMiddleware{
+		{Name: "plugin:gzip"}, {Name: "plugin:logging"},
+	}))
+	require.Equal(t, true, appliedMiddlewareStackPatternMatches(pattern, []AppliedMiddleware{
+		{Name: "plugin:lz4"}, {Name: "plugin:logging"},
+	}))
+	require.Equal(t, false, appliedMiddlewareStackPatternMatches(pattern, []AppliedMiddleware{
+		{Name: "plugin:zstd"}, {Name: "plugin:logging"},
+	}))
+}
+
+func TestAppliedMiddlewareStackPatternSequenceQuantifierPreservesOneBehavior(t *testing.T) {
+	// With every Quantifier left at its zero value (One), the new
+	// engine must reproduce the original exact-length sequence
+	// semantics already covered by TestAppliedMiddlewareStackPatternTopSequence.
+	pattern := AppliedMiddlewareStackPattern{
+		TopSequence: []SequenceElement{
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:plugin1"}}}},
+			{Pattern: AppliedMiddlewarePattern{Name: []StringPattern{{Exactly: "plugin:plugin2"}}}},
+		},
+	}
+
+	require.Equal(t, true, appliedMiddlewareStackPatternMatches(pattern, []AppliedMiddleware{
+		{Name: "plugin:plugin1"}, {Name: "plugin:plugin2"},
+	}))
+	require.Equal(t, false, appliedMiddlewareStackPatternMatches(pattern, []AppliedMiddleware{
+		{Name: "plugin:plugin0"}, {Name: "plugin:plugin1"}, {Name: "plugin:plugin2"},
+	}))
+}
+
+func TestPatternSecretID(t *testing.T) {
+	secret := TypeSecret
+	mountpoint := &MountPoint{
+		Destination: "/run/secrets/db-password",
+		Type:        TypeSecret,
+		SecretID:    "a1b2c3",
+	}
+
+	require.Equal(t, true, PatternMatches(MountPointPattern{Type: &secret}, mountpoint))
+	require.Equal(t, true, PatternMatches(MountPointPattern{SecretID: []StringPattern{{Exactly: "a1b2c3"}}}, mountpoint))
+	require.Equal(t, false, PatternMatches(MountPointPattern{SecretID: []StringPattern{{Exactly: "other"}}}, mountpoint))
+	require.Equal(t, true, PatternMatches(MountPointPattern{SecretID: []StringPattern{{Not: true, Exactly: "other"}}}, mountpoint))
+
+	bind := TypeBind
+	require.Equal(t, false, PatternMatches(MountPointPattern{Type: &bind}, mountpoint))
 }
@@ -0,0 +1,159 @@
+package mountpoint
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+// RewriteContext carries the per-container values a MountPointRewrite's
+// replacement strings may reference via ${...} substitutions, so a
+// rewrite resolves against the container being mounted rather than
+// global daemon state. Fields are looked up by the substitution names
+// documented on expand.
+type RewriteContext struct {
+	ContainerID   string
+	ContainerName string
+	Image         string
+	User          string
+	WorkspaceRoot string
+}
+
+// expand replaces ${container.id}, ${container.name}, ${image}, ${user}
+// and ${workspace} references in s with the corresponding RewriteContext
+// field. References that don't match one of these names are left as-is.
+func (ctx RewriteContext) expand(s string) string {
+	return strings.NewReplacer(
+		"${container.id}", ctx.ContainerID,
+		"${container.name}", ctx.ContainerName,
+		"${image}", ctx.Image,
+		"${user}", ctx.User,
+		"${workspace}", ctx.WorkspaceRoot,
+	).Replace(s)
+}
+
+// MountPointRewrite describes edits to make to a MountPoint matched by a
+// MountPointRewriter's Pattern. Every field is nil/empty by default,
+// which leaves that aspect of the mount untouched. The string-valued
+// replacement fields may contain RewriteContext substitutions (see
+// RewriteContext.expand).
+type MountPointRewrite struct {
+	EffectiveSource *string            `json:",omitempty"`
+	Destination     *string            `json:",omitempty"`
+	Mode            *string            `json:",omitempty"`
+	Propagation     *mount.Propagation `json:",omitempty"`
+	Consistency     *mount.Consistency `json:",omitempty"`
+
+	// AddLabels sets (or overwrites) the given labels on the mount;
+	// values are expanded against the RewriteContext. RemoveLabels
+	// deletes the named labels. AddLabels is applied first, so a
+	// rewriter can't use the two together to add and remove the same
+	// key in one step.
+	AddLabels    map[string]string `json:",omitempty"`
+	RemoveLabels []string          `json:",omitempty"`
+
+	// AddAppliedMiddleware appends entries to the mount's applied
+	// middleware stack, as if that middleware had run during normal
+	// attachment. RemoveAppliedMiddleware drops every applied
+	// middleware whose Name matches one of the given names.
+	AddAppliedMiddleware    []AppliedMiddleware `json:",omitempty"`
+	RemoveAppliedMiddleware []string            `json:",omitempty"`
+}
+
+// MountPointRewriter pairs a Pattern with the MountPointRewrite to apply
+// to any MountPoint it matches.
+type MountPointRewriter struct {
+	Pattern MountPointPattern
+	Rewrite MountPointRewrite
+}
+
+// Rewrite applies r's edits to mp in place if r.Pattern matches mp's
+// current state, expanding any RewriteContext substitutions in the
+// replacement strings. changed reports whether mp was modified.
+func (r MountPointRewriter) Rewrite(ctx RewriteContext, mp *MountPoint) (changed bool, err error) {
+	if !PatternMatches(r.Pattern, mp) {
+		return false, nil
+	}
+
+	rw := r.Rewrite
+
+	if rw.EffectiveSource != nil {
+		mp.EffectiveSource = ctx.expand(*rw.EffectiveSource)
+		changed = true
+	}
+	if rw.Destination != nil {
+		mp.Destination = ctx.expand(*rw.Destination)
+		changed = true
+	}
+	if rw.Mode != nil {
+		mp.Mode = ctx.expand(*rw.Mode)
+		changed = true
+	}
+	if rw.Propagation != nil {
+		mp.Propagation = *rw.Propagation
+		changed = true
+	}
+	if rw.Consistency != nil {
+		mp.Consistency = *rw.Consistency
+		changed = true
+	}
+
+	if len(rw.AddLabels) > 0 {
+		if mp.Labels == nil {
+			mp.Labels = map[string]string{}
+		}
+		for k, v := range rw.AddLabels {
+			mp.Labels[k] = ctx.expand(v)
+		}
+		changed = true
+	}
+	for _, k := range rw.RemoveLabels {
+		if _, ok := mp.Labels[k]; ok {
+			delete(mp.Labels, k)
+			changed = true
+		}
+	}
+
+	if len(rw.AddAppliedMiddleware) > 0 {
+		mp.AppliedMiddleware = append(mp.AppliedMiddleware, rw.AddAppliedMiddleware...)
+		changed = true
+	}
+	if len(rw.RemoveAppliedMiddleware) > 0 {
+		remove := make(map[string]bool, len(rw.RemoveAppliedMiddleware))
+		for _, name := range rw.RemoveAppliedMiddleware {
+			remove[name] = true
+		}
+		kept := mp.AppliedMiddleware[:0]
+		for _, applied := range mp.AppliedMiddleware {
+			if remove[applied.Name] {
+				changed = true
+				continue
+			}
+			kept = append(kept, applied)
+		}
+		mp.AppliedMiddleware = kept
+	}
+
+	return changed, nil
+}
+
+// RewriterChain applies a sequence of MountPointRewriters to a mount
+// point, in order. Later rewriters see the output of earlier ones, so a
+// chain can redirect a path in one rewriter and, in a later rewriter
+// whose Pattern matches the rewritten Destination, adjust its
+// consistency or label it.
+type RewriterChain []MountPointRewriter
+
+// Rewrite applies every rewriter in the chain whose Pattern matches mp's
+// current state, in order, returning whether any of them changed mp. It
+// stops and returns the error from the first rewriter that fails.
+func (c RewriterChain) Rewrite(ctx RewriteContext, mp *MountPoint) (changed bool, err error) {
+	for _, rewriter := range c {
+		didChange, err := rewriter.Rewrite(ctx, mp)
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || didChange
+	}
+	return changed, nil
+}
@@ -0,0 +1,122 @@
+package mountpoint
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteContextExpand(t *testing.T) {
+	ctx := RewriteContext{
+		ContainerID:   "abc123",
+		ContainerName: "web-1",
+		Image:         "nginx",
+		User:          "deploy",
+		WorkspaceRoot: "/mnt/workspace",
+	}
+
+	require.Equal(t, "/mnt/workspace/web-1", ctx.expand("${workspace}/${container.name}"))
+	require.Equal(t, "unrecognized ${nope}", ctx.expand("unrecognized ${nope}"))
+}
+
+func homeSrcRewriter() MountPointRewriter {
+	workspace := "${workspace}"
+	return MountPointRewriter{
+		Pattern: MountPointPattern{
+			Type:   typePtr(TypeBind),
+			Source: []StringPattern{{Glob: "/home/*/src"}},
+		},
+		Rewrite: MountPointRewrite{
+			EffectiveSource: &workspace,
+		},
+	}
+}
+
+func typePtr(t Type) *Type {
+	return &t
+}
+
+func TestMountPointRewriterRedirectsMatchingMount(t *testing.T) {
+	ctx := RewriteContext{WorkspaceRoot: "/mnt/workspace"}
+	mp := &MountPoint{
+		Type:        TypeBind,
+		Source:      "/home/alice/src",
+		Destination: "/src",
+		ReadOnly:    true,
+		Consistency: mount.ConsistencyCached,
+	}
+
+	changed, err := homeSrcRewriter().Rewrite(ctx, mp)
+	require.Nil(t, err)
+	require.Equal(t, true, changed)
+	require.Equal(t, "/mnt/workspace", mp.EffectiveSource)
+	require.Equal(t, true, mp.ReadOnly)
+	require.Equal(t, mount.ConsistencyCached, mp.Consistency)
+}
+
+func TestMountPointRewriterLeavesNonMatchingMountUnchanged(t *testing.T) {
+	ctx := RewriteContext{WorkspaceRoot: "/mnt/workspace"}
+	mp := &MountPoint{
+		Type:   TypeBind,
+		Source: "/var/lib/data",
+	}
+
+	changed, err := homeSrcRewriter().Rewrite(ctx, mp)
+	require.Nil(t, err)
+	require.Equal(t, false, changed)
+	require.Equal(t, "", mp.EffectiveSource)
+}
+
+func TestMountPointRewriterAddAndRemoveLabels(t *testing.T) {
+	rewriter := MountPointRewriter{
+		Pattern: MountPointPattern{},
+		Rewrite: MountPointRewrite{
+			AddLabels:    map[string]string{"owner": "${user}"},
+			RemoveLabels: []string{"stale"},
+		},
+	}
+	mp := &MountPoint{Labels: map[string]string{"stale": "yes"}}
+
+	changed, err := rewriter.Rewrite(RewriteContext{User: "deploy"}, mp)
+	require.Nil(t, err)
+	require.Equal(t, true, changed)
+	require.Equal(t, map[string]string{"owner": "deploy"}, mp.Labels)
+}
+
+func TestMountPointRewriterAddAndRemoveAppliedMiddleware(t *testing.T) {
+	rewriter := MountPointRewriter{
+		Pattern: MountPointPattern{},
+		Rewrite: MountPointRewrite{
+			AddAppliedMiddleware:    []AppliedMiddleware{{Name: "audit"}},
+			RemoveAppliedMiddleware: []string{"quota"},
+		},
+	}
+	mp := &MountPoint{
+		AppliedMiddleware: []AppliedMiddleware{{Name: "quota"}, {Name: "encrypt"}},
+	}
+
+	changed, err := rewriter.Rewrite(RewriteContext{}, mp)
+	require.Nil(t, err)
+	require.Equal(t, true, changed)
+	require.Equal(t, []AppliedMiddleware{{Name: "encrypt"}, {Name: "audit"}}, mp.AppliedMiddleware)
+}
+
+func TestRewriterChainAppliesInOrder(t *testing.T) {
+	workspace := "/mnt/workspace"
+	consistent := mount.ConsistencyCached
+	chain := RewriterChain{
+		homeSrcRewriter(),
+		{
+			Pattern: MountPointPattern{EffectiveSource: []StringPattern{{Exactly: workspace}}},
+			Rewrite: MountPointRewrite{Consistency: &consistent},
+		},
+	}
+
+	mp := &MountPoint{Type: TypeBind, Source: "/home/bob/src"}
+	changed, err := chain.Rewrite(RewriteContext{WorkspaceRoot: workspace}, mp)
+	require.Nil(t, err)
+	require.Equal(t, true, changed)
+	require.Equal(t, workspace, mp.EffectiveSource)
+	require.Equal(t, mount.ConsistencyCached, mp.Consistency)
+}
@@ -1,109 +1,789 @@
 package volume
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
+	"github.com/docker/distribution/reference"
 	mounttypes "github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/pkg/plugingetter"
 	"github.com/docker/docker/volume/mountpoint"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/pkg/errors"
 )
 
+// maxConcurrentMiddlewareAttach bounds how many attach/detach RPCs the
+// chain will have in flight at once across a single AttachMounts batch,
+// so a container with many middleware plugins can't exhaust file
+// descriptors or flood a plugin's unix socket.
+const maxConcurrentMiddlewareAttach = 8
+
 // MountPointChain uses a list of mount point middleware to interpose
 // on mount point attachment and detachment
 type MountPointChain struct {
 	mu         sync.Mutex
 	middleware []mountpoint.Middleware
+
+	// containers serializes AttachMounts/DetachMounts per container, so
+	// that mu only ever needs to be held long enough to snapshot the
+	// middleware slice and one container's slow plugin doesn't block
+	// start/stop of any other container.
+	containers containerLocks
+
+	// breakersMu guards breakers, deadlines and policies.
+	breakersMu sync.Mutex
+	breakers   map[string]*circuitBreaker
+	deadlines  map[string]time.Duration
+	policies   map[string]MiddlewarePolicy
+
+	// specModifiersMu guards specModifiers.
+	specModifiersMu sync.Mutex
+	// specModifiers holds, per container ID, the OCI runtime spec
+	// modifier functions AttachMounts collected from middleware
+	// interposing on that container's mounts, for the container runtime
+	// layer to apply at spec-generation time via SpecModifiers.
+	specModifiers map[string][]func(*specs.Spec) error
+
+	// journalDir is the directory, under the daemon root, where
+	// AttachMounts/DetachMounts persist a crash-recovery journal (see
+	// mountpoint_journal.go). Empty disables journaling.
+	journalDir string
+}
+
+// containerLocks hands out a per-container *sync.Mutex from a shared
+// map. Entries are never removed: the map is keyed by container ID, so
+// it grows with the number of distinct containers the daemon has ever
+// attached mounts for, which is negligible next to the rest of a
+// container's in-memory state.
+type containerLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
 }
 
-// NewMountPointChain creates a new Chain with a slice of plugin names.
+// lock acquires the per-container lock for id and returns a function
+// that releases it.
+func (l *containerLocks) lock(id string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := l.locks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		l.locks[id] = lock
+	}
+	l.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// NewMountPointChain creates a new Chain with a slice of plugin
+// references, each of the form "[alias=]name[@digest]".
 func NewMountPointChain(names []string, pg plugingetter.PluginGetter) (*MountPointChain, error) {
 	mountpoint.SetPluginGetter(pg)
-	plugins, err := mountpoint.NewPlugins(names)
+	middleware, err := resolvePluginRefs(names)
 	if err != nil {
 		return nil, err
 	}
-	middleware := make([]mountpoint.Middleware, len(plugins))
-	for i := range plugins {
-		middleware[i] = plugins[i]
-	}
 	return &MountPointChain{
 		middleware: middleware,
 	}, nil
 }
 
-// AttachMounts runs a list of mount attachments through a mount point middleware chain
-func (c *MountPointChain) AttachMounts(id string, mounts []*MountPoint) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// pinnedMiddleware wraps a mountpoint.Middleware to expose an
+// operator-chosen alias as its Name(), so a plugin can be pinned to a
+// digest under a stable, user-facing name while the plugin getter is
+// free to resolve the underlying plugin name to a different digest for
+// new middleware references.
+type pinnedMiddleware struct {
+	mountpoint.Middleware
+	alias string
+}
+
+func (p pinnedMiddleware) Name() string {
+	return p.alias
+}
+
+// resolvePluginRefs resolves a daemon config middleware list -- each
+// entry of the form "[alias=]name[@digest]" -- against the current
+// plugin set, verifying that any digest pin matches what the plugin
+// getter resolves for that name and renaming the middleware to its
+// alias (if given) so mount point patterns and unwind can refer to it
+// by a stable name across plugin upgrades.
+func resolvePluginRefs(names []string) ([]mountpoint.Middleware, error) {
+	refs := make([]mountpoint.PluginRef, len(names))
+	for i, name := range names {
+		refs[i] = mountpoint.ParsePluginRef(name)
+	}
+	return resolveMiddlewareRefs(refs)
+}
+
+// resolveMiddlewareRefs is the shared tail of resolvePluginRefs and
+// NewChainFromRefs: given already-parsed PluginRefs, it resolves each
+// against the current plugin set, verifies any digest pin, renames the
+// middleware to its alias, and validates its patterns.
+func resolveMiddlewareRefs(refs []mountpoint.PluginRef) ([]mountpoint.Middleware, error) {
+	plainNames := make([]string, len(refs))
+	for i, ref := range refs {
+		plainNames[i] = ref.Name
+	}
+
+	plugins, err := mountpoint.NewPlugins(plainNames)
+	if err != nil {
+		return nil, err
+	}
+
+	middleware := make([]mountpoint.Middleware, len(plugins))
+	for i := range plugins {
+		ref := refs[i]
+		var m mountpoint.Middleware = plugins[i]
+
+		if ref.Digest != "" && m.Digest() != ref.Digest {
+			return nil, fmt.Errorf("mount point middleware %s resolved to digest %s, expected %s", ref.Name, m.Digest(), ref.Digest)
+		}
+
+		aliasName := ref.Alias
+		if mountpoint.PluginNameOfMiddlewareName(m.Name()) != "" {
+			aliasName = "plugin:" + ref.Alias
+		}
+		if aliasName != m.Name() {
+			m = pinnedMiddleware{Middleware: m, alias: aliasName}
+		}
+
+		if err := validateMiddlewarePatterns(m); err != nil {
+			return nil, fmt.Errorf("mount point middleware %s: %s", m.Name(), err)
+		}
+
+		middleware[i] = m
+	}
+	return middleware, nil
+}
+
+// NewChainFromRefs is the content-addressable-reference counterpart of
+// NewMountPointChain: rather than "[alias=]name[@digest]" strings, refs
+// are normalized distribution references, each optionally implementing
+// reference.Digested to pin a manifest digest, so chain composition is
+// reproducible across daemon restarts and node upgrades even if a
+// plugin's tag is later republished to a different digest. aliases, if
+// non-nil, must be the same length as refs and supplies the operator-
+// facing alias for each entry (see PluginRef.Alias); a stage's alias
+// lets the same underlying plugin name appear more than once in the
+// chain pinned to different digests, e.g. a "crypt@sha256:..." stage
+// before a differently-pinned "crypt@sha256:..." stage. Pass nil
+// aliases to default every entry's alias to its reference's name.
+func NewChainFromRefs(refs []reference.Named, aliases []string, pg plugingetter.PluginGetter) (*MountPointChain, error) {
+	if aliases != nil && len(aliases) != len(refs) {
+		return nil, fmt.Errorf("mountpoint: got %d plugin refs but %d aliases", len(refs), len(aliases))
+	}
+
+	pluginRefs := make([]mountpoint.PluginRef, len(refs))
+	for i, ref := range refs {
+		name := ref.Name()
+		digest := ""
+		if digested, ok := ref.(reference.Digested); ok {
+			digest = digested.Digest().String()
+		}
+		alias := name
+		if aliases != nil && aliases[i] != "" {
+			alias = aliases[i]
+		}
+		pluginRefs[i] = mountpoint.PluginRef{Alias: alias, Name: name, Digest: digest}
+	}
+
+	mountpoint.SetPluginGetter(pg)
+	middleware, err := resolveMiddlewareRefs(pluginRefs)
+	if err != nil {
+		return nil, err
+	}
+	return &MountPointChain{middleware: middleware}, nil
+}
+
+// validateMiddlewarePatterns compiles every pattern a middleware
+// interposes on, surfacing a malformed Regex or Glob at registration
+// time -- when the daemon config is loaded or a plugin is enabled --
+// rather than at the first mount request that happens to reach it.
+func validateMiddlewarePatterns(m mountpoint.Middleware) error {
+	for _, pattern := range m.Patterns() {
+		if _, err := mountpoint.Compile(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validPatternsFor re-validates a middleware's self-reported Patterns
+// every time they're fetched, not just once at registration. Unlike
+// the static config a plugin's live PropertiesResponse can change on
+// any MountPointProperties RPC, so a plugin that starts advertising a
+// malformed Regex or Glob after registration must not get to interpose
+// on mounts it was never validated against; the offending pattern is
+// dropped (the rest of the middleware's patterns still apply) and
+// counted in middlewareInvalidPatternsTotal rather than failing the
+// whole attach.
+func validPatternsFor(m mountpoint.Middleware) []mountpoint.MountPointPattern {
+	patterns := m.Patterns()
+	valid := make([]mountpoint.MountPointPattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		if _, err := mountpoint.Compile(pattern); err != nil {
+			middlewareInvalidPatternsTotal.WithLabelValues(m.Name()).Inc()
+			continue
+		}
+		valid = append(valid, pattern)
+	}
+	return valid
+}
 
-	var mountPointClock int
+// propagatedMountFor re-queries m's properties for the PropagatedMount
+// a containerized (v2) mount point plugin declares, discarding any
+// error the same way GRPCMiddleware.Patterns does -- an unreachable
+// plugin is treated as reporting no PropagatedMount rather than failing
+// the attach a second time after MountPointAttach has already
+// succeeded.
+func propagatedMountFor(m mountpoint.Middleware) string {
+	response, err := m.MountPointProperties(&mountpoint.PropertiesRequest{})
+	if err != nil || !response.Success {
+		return ""
+	}
+	return response.PropagatedMount
+}
 
-	for _, middleware := range c.middleware {
-		var selectedMounts []*MountPoint
-		patterns := middleware.Patterns()
+// resolvePropagatedMount joins effectiveSource onto propagatedMount when
+// the middleware that produced it declared one, so a path a
+// containerized mount point plugin returns -- meaningful only inside
+// its own rootfs -- becomes the host-visible path the daemon's mount
+// namespace needs to bind-mount into the target container. Plugins
+// that aren't containerized, or that already return host-visible
+// paths, leave propagatedMount empty and effectiveSource passes through
+// unchanged.
+func resolvePropagatedMount(propagatedMount, effectiveSource string) string {
+	if propagatedMount == "" || effectiveSource == "" {
+		return effectiveSource
+	}
+	return filepath.Join(propagatedMount, effectiveSource)
+}
 
-		mountPointClock++
+// AttachMounts runs a list of mount attachments through a mount point
+// middleware chain. Middleware whose selected mounts are disjoint are
+// dispatched concurrently, bounded by maxConcurrentMiddlewareAttach;
+// mountPointClock values are assigned by chain position before dispatch
+// so that unwind's detach ordering doesn't depend on how attachment was
+// parallelized. ctx bounds the whole call: if it's canceled or expires
+// before every middleware has responded, the mounts already attached are
+// unwound and ctx.Err() is reported. Each individual attach/detach RPC
+// is additionally bounded by its own MiddlewarePolicy timeout regardless
+// of ctx's deadline.
+func (c *MountPointChain) AttachMounts(ctx context.Context, id string, mounts []*MountPoint) error {
+	unlock := c.containers.lock(id)
+	defer unlock()
 
-		// select mounts for this middleware
+	c.mu.Lock()
+	middleware := make([]mountpoint.Middleware, len(c.middleware))
+	copy(middleware, c.middleware)
+	c.mu.Unlock()
+
+	selections := make([][]*MountPoint, len(middleware))
+	clocks := make([]int, len(middleware))
+	for i, mw := range middleware {
+		clocks[i] = i + 1
+		patterns := validPatternsFor(mw)
 		for _, mount := range mounts {
 			for _, pattern := range patterns {
 				if mountpoint.PatternMatches(pattern, middlewareMountPointOfMountPoint(mount)) {
-					selectedMounts = append(selectedMounts, mount)
+					selections[i] = append(selections[i], mount)
 					break
 				}
 			}
 		}
+	}
+
+	c.collectSpecModifiers(id, middleware, selections)
+
+	for _, batch := range independentMiddlewareBatches(selections) {
+		if err := c.attachMiddlewareBatch(ctx, id, mounts, middleware, selections, clocks, batch); err != nil {
+			c.clearSpecModifiers(id)
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			// cleanup must not be cut short by the same cancellation that
+			// triggered it, so unwind runs against a fresh context rather
+			// than the one that just expired
+			c.clearSpecModifiers(id)
+			if unwindErr := c.unwind(context.Background(), id, mounts); unwindErr != nil {
+				return fmt.Errorf("mount point attach canceled (%s) and unwind failed (%s)", err, unwindErr)
+			}
+			return fmt.Errorf("mount point attach canceled, mounts unwound: %s", err)
+		}
+	}
+
+	if c.journalDir != "" {
+		if err := c.writeJournalForContainer(id, mounts); err != nil {
+			c.clearSpecModifiers(id)
+			if unwindErr := c.unwind(context.Background(), id, mounts); unwindErr != nil {
+				return fmt.Errorf("mount point journal write failed (%s) and unwind failed (%s)", err, unwindErr)
+			}
+			return fmt.Errorf("mount point journal write failed, mounts unwound: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// collectSpecModifiers gathers SpecModifiers from every middleware that
+// selected at least one of this AttachMounts call's mounts and stashes
+// them under id, for the container runtime layer to apply at
+// spec-generation time via SpecModifiers. Collected ahead of dispatch,
+// alongside the rest of AttachMounts's preparation, so a modifier is
+// available even if the attach RPC itself is still in flight when the
+// runtime layer asks for it.
+func (c *MountPointChain) collectSpecModifiers(id string, middleware []mountpoint.Middleware, selections [][]*MountPoint) {
+	var modifiers []func(*specs.Spec) error
+	for i, mw := range middleware {
+		if len(selections[i]) == 0 {
+			continue
+		}
+		modifiers = append(modifiers, mw.SpecModifiers()...)
+	}
+	if len(modifiers) == 0 {
+		return
+	}
+
+	c.specModifiersMu.Lock()
+	defer c.specModifiersMu.Unlock()
+	if c.specModifiers == nil {
+		c.specModifiers = map[string][]func(*specs.Spec) error{}
+	}
+	c.specModifiers[id] = append(c.specModifiers[id], modifiers...)
+}
+
+// SpecModifiers returns the OCI runtime spec modifier functions
+// AttachMounts collected for containerID, in chain order, so the
+// container runtime layer can apply them to the container's spec at
+// spec-generation time. Returns nil once DetachMounts has cleared them.
+func (c *MountPointChain) SpecModifiers(containerID string) []func(*specs.Spec) error {
+	c.specModifiersMu.Lock()
+	defer c.specModifiersMu.Unlock()
+	return c.specModifiers[containerID]
+}
+
+// clearSpecModifiers drops the stashed SpecModifiers for containerID,
+// called once DetachMounts has finished unwinding its mounts.
+func (c *MountPointChain) clearSpecModifiers(containerID string) {
+	c.specModifiersMu.Lock()
+	defer c.specModifiersMu.Unlock()
+	delete(c.specModifiers, containerID)
+}
+
+// independentMiddlewareBatches greedily groups middleware indices into
+// batches that can be dispatched concurrently: two middleware share a
+// batch only if their selected mounts are disjoint, since concurrent
+// attach responses for the same mount would race on that mount's
+// applied-middleware stack. Middleware that selected no mounts are
+// dropped; batches preserve the chain's original relative order.
+func independentMiddlewareBatches(selections [][]*MountPoint) [][]int {
+	var batches [][]int
+	assigned := make([]bool, len(selections))
+
+	for i := range selections {
+		if assigned[i] || len(selections[i]) == 0 {
+			continue
+		}
+		batch := []int{i}
+		assigned[i] = true
+		for j := i + 1; j < len(selections); j++ {
+			if assigned[j] || len(selections[j]) == 0 {
+				continue
+			}
+			if disjointMounts(selections[j], batch, selections) {
+				batch = append(batch, j)
+				assigned[j] = true
+			}
+		}
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// disjointMounts reports whether candidate shares no mount with any of
+// the selections already in batch.
+func disjointMounts(candidate []*MountPoint, batch []int, selections [][]*MountPoint) bool {
+	for _, i := range batch {
+		for _, a := range selections[i] {
+			for _, b := range candidate {
+				if a == b {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// middlewareAttachErr pairs a middleware name with the error it
+// returned, so attachMiddlewareBatch can unwind using the same
+// "middleware X failed with error" wrapping as the non-parallel path.
+type middlewareAttachErr struct {
+	name string
+	err  error
+}
+
+// attachMiddlewareBatch dispatches attach requests for the middleware at
+// the given indices concurrently, bounded by
+// maxConcurrentMiddlewareAttach in-flight requests. Each RPC's deadline
+// is derived from ctx, so canceling ctx aborts every in-flight attach in
+// the batch.
+func (c *MountPointChain) attachMiddlewareBatch(ctx context.Context, id string, mounts []*MountPoint, middleware []mountpoint.Middleware, selections [][]*MountPoint, clocks []int, batch []int) error {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentMiddlewareAttach)
+	errs := make(chan middlewareAttachErr, len(batch))
+
+	for _, i := range batch {
+		mw := middleware[i]
+		selectedMounts := selections[i]
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(mw mountpoint.Middleware, clock int, selectedMounts []*MountPoint) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			name := mw.Name()
+			breaker := c.breakerFor(name)
+			if !breaker.allow() {
+				errs <- middlewareAttachErr{name, fmt.Errorf("middleware %s circuit breaker is open, skipping attach", name)}
+				return
+			}
 
-		if len(selectedMounts) > 0 {
-			// send attachment request to the middleware
 			var pmounts []*mountpoint.MountPoint
 			for _, selectedMount := range selectedMounts {
 				pmounts = append(pmounts, middlewareMountPointOfMountPoint(selectedMount))
 			}
 			request := &mountpoint.AttachRequest{id, pmounts}
-			response, err := middleware.MountPointAttach(request)
+			policy := c.policyFor(name, mw)
+
+			var response *mountpoint.AttachResponse
+			var err error
+			for attempt := 0; ; attempt++ {
+				attemptCtx, cancel := context.WithTimeout(ctx, policy.AttachTimeout)
+				start := time.Now()
+				response, err = mw.MountPointAttachContext(attemptCtx, request)
+				middlewareAttachDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+				cancel()
+
+				if err == nil && response.Success {
+					break
+				}
+				if attempt >= policy.MaxRetries || ctx.Err() != nil {
+					break
+				}
+				time.Sleep(backoffDuration(attempt + 1))
+			}
+
 			if err != nil {
-				return c.unwindAttachOnErr(middleware.Name(), id, mounts, err)
+				breaker.recordFailure(name)
+				errs <- middlewareAttachErr{name, err}
+				return
 			}
 			if !response.Success {
-				return c.unwindAttachOnErr(middleware.Name(), id, mounts, errors.New(response.Err))
+				breaker.recordFailure(name)
+				errs <- middlewareAttachErr{name, errors.New(response.Err)}
+				return
 			}
+			breaker.recordSuccess(name)
+
+			propagatedMount := propagatedMountFor(mw)
 
-			// annotate the mount points with the applied middleware
 			for k, attachment := range response.Attachments {
 				if k >= len(selectedMounts) {
 					break
 				}
 				if attachment.Attach {
-					selectedMounts[k].PushMiddleware(middleware, attachment.Changes, mountPointClock)
+					changes := attachment.Changes
+					changes.EffectiveSource = resolvePropagatedMount(propagatedMount, changes.EffectiveSource)
+					selectedMounts[k].PushMiddleware(mw, changes, clock)
 				}
 			}
-		}
+		}(mw, clocks[i], selectedMounts)
 	}
 
+	wg.Wait()
+	close(errs)
+
+	for attachErr := range errs {
+		// report the first failure; the rest of the batch has already
+		// finished by the time wg.Wait() returns
+		return c.unwindAttachOnErr(attachErr.name, id, mounts, attachErr.err)
+	}
 	return nil
 }
 
-// DetachMounts detaches mounts from a mount point middlware chain
-func (c *MountPointChain) DetachMounts(container string, mounts map[string]*MountPoint) error {
+// DetachMounts detaches mounts from a mount point middlware chain. ctx
+// bounds every detach RPC issued while unwinding, in addition to each
+// one's own MiddlewarePolicy.DetachTimeout.
+func (c *MountPointChain) DetachMounts(ctx context.Context, container string, mounts map[string]*MountPoint) error {
+	unlock := c.containers.lock(container)
+	defer unlock()
+
 	var list []*MountPoint
 	for _, mp := range mounts {
 		list = append(list, mp)
 	}
-	return unwind(container, list)
+	if err := c.unwind(ctx, container, list); err != nil {
+		return err
+	}
+	c.clearSpecModifiers(container)
+	if c.journalDir != "" {
+		if err := removeJournal(c.journalDir, container); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MiddlewareNotFoundError is returned by RestoreMounts when a mount's
+// recorded applied middleware can no longer be resolved against the
+// current plugin set, e.g. because the plugin was removed while the
+// daemon was down. The container's mounts are left with whatever
+// middleware did resolve; the caller can retry after re-enabling the
+// plugin or give up on it by calling ForceDetachMounts.
+type MiddlewareNotFoundError struct {
+	ContainerID string
+	Name        string
+}
+
+func (e *MiddlewareNotFoundError) Error() string {
+	return fmt.Sprintf("mount point middleware %q applied to container %s is no longer registered", e.Name, e.ContainerID)
+}
+
+// NonRecoverableAttachmentError is returned by RestoreMounts when a
+// mount's applied middleware no longer covers the mount -- a fresh
+// PropertiesRequest shows its current Patterns don't match -- and the
+// middleware either doesn't implement mountpoint.LiveRestorer or that
+// hook declined to adopt the attachment. The caller should stop the
+// container rather than leave it running against a mount the middleware
+// no longer vouches for.
+type NonRecoverableAttachmentError struct {
+	ContainerID string
+	Name        string
+	Reason      string
+}
+
+func (e *NonRecoverableAttachmentError) Error() string {
+	return fmt.Sprintf("mount point middleware %q applied to container %s no longer covers its mount: %s", e.Name, e.ContainerID, e.Reason)
+}
+
+// middlewareCoversMount re-queries m's properties and reports whether
+// any of its current patterns match mp, so RestoreMounts can tell
+// whether a plugin still vouches for a mount it attached before a
+// live-restore restart.
+func middlewareCoversMount(m mountpoint.Middleware, mp *mountpoint.MountPoint) (bool, error) {
+	response, err := m.MountPointProperties(&mountpoint.PropertiesRequest{})
+	if err != nil {
+		return false, err
+	}
+	if !response.Success {
+		return false, errors.New(response.Err)
+	}
+	for _, pattern := range response.Patterns {
+		if _, err := mountpoint.Compile(pattern); err != nil {
+			middlewareInvalidPatternsTotal.WithLabelValues(m.Name()).Inc()
+			continue
+		}
+		if mountpoint.PatternMatches(pattern, mp) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RestoreMounts re-resolves each mount's recorded AppliedMiddleware stack
+// against the chain's current plugin set after a live-restore daemon
+// startup. It does not re-invoke any middleware's attach: the recorded
+// Name, Attachment and Clock values already reflect what was applied
+// before the restart, and since mountPointClock is scoped to a single
+// AttachMounts call rather than tracked on the chain, restoring those
+// per-mount stacks is sufficient for a later DetachMounts to unwind in
+// the original order. It does, however, reissue a PropertiesRequest to
+// every referenced plugin to confirm its patterns still cover the mount;
+// a plugin that no longer covers it gets one chance, via
+// mountpoint.LiveRestorer, to adopt the attachment anyway before the
+// mount is reported non-recoverable.
+func (c *MountPointChain) RestoreMounts(containerID string, mounts []*MountPoint) error {
+	c.mu.Lock()
+	available := make(map[string]mountpoint.Middleware, len(c.middleware))
+	for _, m := range c.middleware {
+		available[m.Name()] = m
+	}
+	c.mu.Unlock()
+
+	for _, mp := range mounts {
+		pmp := middlewareMountPointOfMountPoint(mp)
+		for i := range mp.AppliedMiddleware {
+			applied := &mp.AppliedMiddleware[i]
+			m, ok := available[applied.Name]
+			if !ok {
+				return &MiddlewareNotFoundError{ContainerID: containerID, Name: applied.Name}
+			}
+
+			covered, err := middlewareCoversMount(m, pmp)
+			if err != nil {
+				return &NonRecoverableAttachmentError{ContainerID: containerID, Name: applied.Name, Reason: err.Error()}
+			}
+			if !covered {
+				restorer, ok := m.(mountpoint.LiveRestorer)
+				if !ok {
+					return &NonRecoverableAttachmentError{ContainerID: containerID, Name: applied.Name, Reason: "pattern no longer covers this mount"}
+				}
+				adopt, err := restorer.LiveRestoreAttachment(pmp, mountpointAppliedMiddlewareOf(*applied))
+				if err != nil {
+					return &NonRecoverableAttachmentError{ContainerID: containerID, Name: applied.Name, Reason: err.Error()}
+				}
+				if !adopt {
+					return &NonRecoverableAttachmentError{ContainerID: containerID, Name: applied.Name, Reason: "middleware declined to adopt attachment"}
+				}
+			}
+
+			applied.middleware = &m
+		}
+	}
+	return nil
+}
+
+// ReconcileMounts asks every middleware that's applied to one or more of
+// mounts and implements mountpoint.Reconciler to reconcile its view of
+// those attachments in a single MountPointReconcile RPC per middleware,
+// batching every mount that middleware covers instead of the
+// one-call-per-mount mountpoint.LiveRestorer hook RestoreMounts already
+// uses. Middleware that doesn't implement Reconciler is left untouched
+// -- reconciliation is opt-in. Call RestoreMounts first so every mount's
+// AppliedMiddleware stack resolves to a live Middleware before this runs.
+func (c *MountPointChain) ReconcileMounts(containerID string, mounts []*MountPoint) error {
+	type selection struct {
+		middleware mountpoint.Middleware
+		mounts     []*MountPoint
+	}
+	selections := map[string]*selection{}
+	var order []string
+
+	for _, mp := range mounts {
+		for i := range mp.AppliedMiddleware {
+			name := mp.AppliedMiddleware[i].Name
+			sel, ok := selections[name]
+			if !ok {
+				m, err := mp.AppliedMiddleware[i].Middleware()
+				if err != nil {
+					return err
+				}
+				sel = &selection{middleware: *m}
+				selections[name] = sel
+				order = append(order, name)
+			}
+			sel.mounts = append(sel.mounts, mp)
+		}
+	}
+
+	for _, name := range order {
+		sel := selections[name]
+		reconciler, ok := sel.middleware.(mountpoint.Reconciler)
+		if !ok {
+			continue
+		}
+
+		pmounts := make([]*mountpoint.MountPoint, len(sel.mounts))
+		for i, mp := range sel.mounts {
+			pmounts[i] = middlewareMountPointOfMountPoint(mp)
+		}
+
+		response, err := reconciler.MountPointReconcile(&mountpoint.ReconcileRequest{ID: containerID, Mounts: pmounts})
+		if err != nil {
+			return fmt.Errorf("mount point middleware %s: reconcile error: %s", name, err)
+		}
+		if !response.Success {
+			return fmt.Errorf("mount point middleware %s: reconcile error: %s", name, response.Err)
+		}
+
+		for i, mp := range sel.mounts {
+			action := mountpoint.ReconcileKeep
+			if i < len(response.Decisions) {
+				action = response.Decisions[i]
+			}
+			if action == mountpoint.ReconcileKeep || action == "" {
+				continue
+			}
+
+			top := mp.PopMiddleware()
+			if top == nil || top.Name != name {
+				if top != nil {
+					mp.AppliedMiddleware = append(mp.AppliedMiddleware, *top)
+				}
+				return fmt.Errorf("mount point middleware %s: cannot reconcile mount %s, another middleware is on top of its AppliedMiddleware stack", name, mp.Destination)
+			}
+
+			breaker := c.breakerFor(name)
+			policy := c.policyFor(name, sel.middleware)
+
+			ctx, cancel := context.WithTimeout(context.Background(), policy.DetachTimeout)
+			detachResponse, detachErr := sel.middleware.MountPointDetachContext(ctx, &mountpoint.DetachRequest{ID: containerID})
+			cancel()
+			if detachErr != nil || !detachResponse.Success {
+				breaker.recordFailure(name)
+				mp.AppliedMiddleware = append(mp.AppliedMiddleware, *top)
+				if detachErr != nil {
+					return fmt.Errorf("mount point middleware %s: reconcile detach error for mount %s: %s", name, mp.Destination, detachErr)
+				}
+				return fmt.Errorf("mount point middleware %s: reconcile detach error for mount %s: %s", name, mp.Destination, detachResponse.Err)
+			}
+			breaker.recordSuccess(name)
+
+			if action == mountpoint.ReconcileDrop {
+				continue
+			}
+
+			attachCtx, attachCancel := context.WithTimeout(context.Background(), policy.AttachTimeout)
+			attachResponse, attachErr := sel.middleware.MountPointAttachContext(attachCtx, &mountpoint.AttachRequest{ID: containerID, Mounts: []*mountpoint.MountPoint{middlewareMountPointOfMountPoint(mp)}})
+			attachCancel()
+			if attachErr != nil {
+				breaker.recordFailure(name)
+				return fmt.Errorf("mount point middleware %s: reconcile redo attach error for mount %s: %s", name, mp.Destination, attachErr)
+			}
+			if !attachResponse.Success || len(attachResponse.Attachments) == 0 || !attachResponse.Attachments[0].Attach {
+				breaker.recordFailure(name)
+				return fmt.Errorf("mount point middleware %s: reconcile redo attach declined for mount %s", name, mp.Destination)
+			}
+			breaker.recordSuccess(name)
+			mp.PushMiddleware(sel.middleware, attachResponse.Attachments[0].Changes, top.Clock)
+		}
+	}
+
+	return nil
+}
+
+// ForceDetachMounts drops the recorded AppliedMiddleware state for mounts
+// whose middleware RestoreMounts could not resolve, so that a container
+// being force-removed isn't blocked forever on a plugin that will never
+// come back.
+func (c *MountPointChain) ForceDetachMounts(mounts []*MountPoint) {
+	for _, mp := range mounts {
+		mp.AppliedMiddleware = nil
+	}
 }
 
 // unwindAttachOnErr will clean up previous attachments if an error
-// occurs during attachment
+// occurs during attachment. Cleanup always runs against a fresh
+// context rather than whatever ctx AttachMounts was given, since that
+// ctx may be the very one whose cancellation triggered this unwind and
+// cleanup must not be cut short by it.
 func (c *MountPointChain) unwindAttachOnErr(middlewareName, container string, mounts []*MountPoint, err error) (ret error) {
 	defer func() {
 		ret = errors.Wrap(ret, "middleware "+middlewareName+" failed with error")
 	}()
 
-	e := unwind(container, mounts)
+	e := c.unwind(context.Background(), container, mounts)
 	if e != nil {
 		return errors.Wrap(err, fmt.Sprintf("%s", e))
 	}
@@ -119,8 +799,9 @@ func (c *MountPointChain) unwindAttachOnErr(middlewareName, container string, mo
 // changes during setup, not all middleware apply to all mounts, and
 // middleware application is local to each mount point, we use a counter
 // (clock) to keep track of the order that middlware were applied in the
-// mount point applied middleware stacks.
-func unwind(container string, mounts []*MountPoint) error {
+// mount point applied middleware stacks. Each detach RPC's deadline is
+// derived from ctx in addition to its own MiddlewarePolicy.DetachTimeout.
+func (c *MountPointChain) unwind(ctx context.Context, container string, mounts []*MountPoint) error {
 	var err error
 	var middleware *mountpoint.Middleware
 	moreToUnwind := true
@@ -136,6 +817,14 @@ func unwind(container string, mounts []*MountPoint) error {
 
 		if maxClock > 0 {
 			moreToUnwind = true
+
+			// poppedFrom tracks which mount each popped AppliedMountPointMiddleware
+			// came from, so a non-recoverable detach failure can restore
+			// this round's pops before returning and leave the caller an
+			// accurate stack to retry against.
+			var poppedFrom []*MountPoint
+			var popped []AppliedMountPointMiddleware
+
 			for _, mount := range mounts {
 				// if the top middleware on this mount isn't the next to
 				// detach, skip this mount
@@ -145,6 +834,9 @@ func unwind(container string, mounts []*MountPoint) error {
 
 				appliedMiddleware := mount.PopMiddleware()
 				if appliedMiddleware != nil {
+					poppedFrom = append(poppedFrom, mount)
+					popped = append(popped, *appliedMiddleware)
+
 					// if we don't yet have the middleware object, get it
 					// otherwise, check that the name of the applied
 					// middleware for this mount is indeed the same as our
@@ -152,29 +844,47 @@ func unwind(container string, mounts []*MountPoint) error {
 					if middleware == nil {
 						m, e := appliedMiddleware.Middleware()
 						if e != nil {
+							restoreUnwindPops(poppedFrom, popped)
 							errString := fmt.Sprintf("unwind middleware retrieval error: \"%s\"", e)
 							return stackError(err, errString)
 						}
 						middleware = m
 					} else if (*middleware).Name() != appliedMiddleware.Name {
+						restoreUnwindPops(poppedFrom, popped)
 						return fmt.Errorf("middleware inconsistency %s != %s", (*middleware).Name(), appliedMiddleware.Name)
+					} else if appliedMiddleware.Digest != "" && (*middleware).Digest() != appliedMiddleware.Digest {
+						restoreUnwindPops(poppedFrom, popped)
+						return fmt.Errorf("middleware %s digest inconsistency %s != %s", appliedMiddleware.Name, (*middleware).Digest(), appliedMiddleware.Digest)
 					}
 				}
 			}
 			// send the middleware the mount point detach request and deal
 			// with both protocol errors and detachment errors
+			name := (*middleware).Name()
+			breaker := c.breakerFor(name)
+			policy := c.policyFor(name, *middleware)
+
+			detachCtx, cancel := context.WithTimeout(ctx, policy.DetachTimeout)
 			request := &mountpoint.DetachRequest{container}
-			response, e := (*middleware).MountPointDetach(request)
+			response, e := (*middleware).MountPointDetachContext(detachCtx, request)
+			cancel()
+
 			if e != nil {
-				errString := fmt.Sprintf("unwind detach API error for %s: \"%s\"", (*middleware).Name(), e)
+				breaker.recordFailure(name)
+				restoreUnwindPops(poppedFrom, popped)
+				errString := fmt.Sprintf("unwind detach API error for %s: \"%s\"", name, e)
 				return stackError(err, errString)
 			}
 			if !response.Success {
-				errString := fmt.Sprintf("unwind detach middleware %s error: \"%s\"", (*middleware).Name(), response.Err)
+				breaker.recordFailure(name)
+				errString := fmt.Sprintf("unwind detach middleware %s error: \"%s\"", name, response.Err)
 				err = stackError(err, errString)
 				if !response.Recoverable {
+					restoreUnwindPops(poppedFrom, popped)
 					return err
 				}
+			} else {
+				breaker.recordSuccess(name)
 			}
 		}
 		middleware = nil
@@ -182,6 +892,17 @@ func unwind(container string, mounts []*MountPoint) error {
 	return err
 }
 
+// restoreUnwindPops pushes this unwind round's popped AppliedMountPointMiddleware
+// entries back onto the mounts they came from, so a detach failure that
+// halts unwinding leaves the caller a stack that still reflects reality
+// rather than one missing the entries this round popped but never
+// successfully detached.
+func restoreUnwindPops(poppedFrom []*MountPoint, popped []AppliedMountPointMiddleware) {
+	for i, mount := range poppedFrom {
+		mount.AppliedMiddleware = append(mount.AppliedMiddleware, popped[i])
+	}
+}
+
 // stackError will wrap err in errString if err is an error or create
 // a new error from errString if err is nil
 func stackError(err error, errString string) error {
@@ -199,18 +920,16 @@ func max(a, b int) int {
 	return a
 }
 
-// SetPlugins sets the mount point plugins in the chain
+// SetPlugins sets the mount point plugins in the chain from a slice of
+// plugin references, each of the form "[alias=]name[@digest]".
 func (c *MountPointChain) SetPlugins(names []string) (err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	var plugins []mountpoint.Plugin
-	if plugins, err = mountpoint.NewPlugins(names); err != nil {
+	middleware, err := resolvePluginRefs(names)
+	if err != nil {
 		return err
 	}
-	c.middleware = make([]mountpoint.Middleware, len(plugins))
-	for i := range plugins {
-		c.middleware[i] = plugins[i]
-	}
+	c.middleware = middleware
 	return nil
 }
 
@@ -234,18 +953,24 @@ func (c *MountPointChain) DisableMountPointMiddleware(name string) {
 	c.middleware = middleware
 }
 
-// EnableMountPointPlugin appends a mount point plugin to the chain
+// EnableMountPointPlugin appends a mount point plugin to the chain. name
+// may be a plain plugin name or a pinned reference of the form
+// "[alias=]name[@digest]".
 func (c *MountPointChain) EnableMountPointPlugin(name string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	plugin, err := mountpoint.NewMountPointPlugin(name)
+	middleware, err := resolvePluginRefs([]string{name})
 	if err != nil {
 		return err
 	}
-	c.middleware = append(c.middleware, plugin)
+	c.middleware = append(c.middleware, middleware...)
 	return nil
 }
 
+// mountPointTypeOfAPIType has no case for mountpoint.TypeBlock: unlike
+// TypeSecret and TypeNamedPipe, it has no corresponding mounttypes.Type
+// constant upstream to map from, so a block-device MountPoint built
+// through the API always resolves to the zero mountpoint.Type here.
 func mountPointTypeOfAPIType(t mounttypes.Type) mountpoint.Type {
 	var typ mountpoint.Type
 	switch t {
@@ -255,6 +980,8 @@ func mountPointTypeOfAPIType(t mounttypes.Type) mountpoint.Type {
 		typ = mountpoint.TypeVolume
 	case mounttypes.TypeTmpfs:
 		typ = mountpoint.TypeTmpfs
+	case mounttypes.TypeNamedPipe:
+		typ = mountpoint.TypeNamedPipe
 	}
 	return typ
 }
@@ -268,10 +995,8 @@ func middlewareMountPointOfMountPoint(mp *MountPoint) *mountpoint.MountPoint {
 		driverOptions = mp.Spec.VolumeOptions.DriverConfig.Options
 	}
 	var scope mountpoint.Scope
-	var options map[string]string
 	if v, ok := mp.Volume.(DetailedVolume); ok {
 		scope = mountpoint.Scope(v.Scope())
-		options = v.Options()
 	}
 	var sizeBytes int64
 	var mode os.FileMode
@@ -287,26 +1012,31 @@ func middlewareMountPointOfMountPoint(mp *MountPoint) *mountpoint.MountPoint {
 		Name:              mp.Name,
 		Driver:            mp.Driver,
 		Type:              typ,
-		Mode:              mp.Mode,
+		Mode:              mp.EffectiveMode(),
 		Propagation:       mp.Propagation,
 		ID:                mp.ID,
+		SecretID:          mp.SecretID,
 		Consistency:       mp.Spec.Consistency,
 		Labels:            labels,
 		DriverOptions:     driverOptions,
 		Scope:             scope,
 		SizeBytes:         sizeBytes,
 		MountMode:         mode,
-		Options:           options,
+		Options:           mp.EffectiveOptions(),
 		AppliedMiddleware: middlewareAppliedMiddlewareOfAppliedMiddleware(mp.AppliedMiddleware),
 	}
 }
 
+func mountpointAppliedMiddlewareOf(applied AppliedMountPointMiddleware) mountpoint.AppliedMiddleware {
+	return mountpoint.AppliedMiddleware{
+		Name:       applied.Name,
+		MountPoint: applied.Attachment,
+	}
+}
+
 func middlewareAppliedMiddlewareOfAppliedMiddleware(middleware []AppliedMountPointMiddleware) (ms []mountpoint.AppliedMiddleware) {
 	for _, m := range middleware {
-		ms = append(ms, mountpoint.AppliedMiddleware{
-			Name:    m.Name,
-			Changes: m.Changes,
-		})
+		ms = append(ms, mountpointAppliedMiddlewareOf(m))
 	}
 
 	return ms
@@ -0,0 +1,545 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+	mounttypes "github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/volume/mountpoint"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/require"
+)
+
+// benchMiddleware is a no-op mountpoint.Middleware used to benchmark
+// MountPointChain.AttachMounts without any real plugin RPC overhead.
+type benchMiddleware struct {
+	name string
+}
+
+func (m *benchMiddleware) Name() string       { return m.name }
+func (m *benchMiddleware) PluginName() string { return "" }
+func (m *benchMiddleware) Digest() string     { return "" }
+
+func (m *benchMiddleware) Patterns() []mountpoint.MountPointPattern {
+	// a single zero-value pattern matches every mount
+	return []mountpoint.MountPointPattern{{}}
+}
+
+func (m *benchMiddleware) MountPointProperties(*mountpoint.PropertiesRequest) (*mountpoint.PropertiesResponse, error) {
+	return &mountpoint.PropertiesResponse{Success: true}, nil
+}
+
+func (m *benchMiddleware) MountPointAttach(req *mountpoint.AttachRequest) (*mountpoint.AttachResponse, error) {
+	attachments := make([]mountpoint.Attachment, len(req.Mounts))
+	for i := range req.Mounts {
+		attachments[i] = mountpoint.Attachment{Attach: true}
+	}
+	return &mountpoint.AttachResponse{Success: true, Attachments: attachments}, nil
+}
+
+func (m *benchMiddleware) MountPointDetach(*mountpoint.DetachRequest) (*mountpoint.DetachResponse, error) {
+	return &mountpoint.DetachResponse{Success: true}, nil
+}
+
+func (m *benchMiddleware) MountPointAttachContext(ctx context.Context, req *mountpoint.AttachRequest) (*mountpoint.AttachResponse, error) {
+	return m.MountPointAttach(req)
+}
+
+func (m *benchMiddleware) MountPointDetachContext(ctx context.Context, req *mountpoint.DetachRequest) (*mountpoint.DetachResponse, error) {
+	return m.MountPointDetach(req)
+}
+
+func (m *benchMiddleware) SpecModifiers() []func(*specs.Spec) error { return nil }
+
+// BenchmarkAttachMounts50MountsFiveMiddleware exercises AttachMounts for
+// a 50-mount container passing through 5 middleware plugins, the shape
+// parallel dispatch is meant to help most.
+func BenchmarkAttachMounts50MountsFiveMiddleware(b *testing.B) {
+	middleware := make([]mountpoint.Middleware, 5)
+	for i := range middleware {
+		middleware[i] = &benchMiddleware{name: fmt.Sprintf("plugin:bench%d", i)}
+	}
+	chain := &MountPointChain{middleware: middleware}
+
+	mounts := make([]*MountPoint, 50)
+	for i := range mounts {
+		mounts[i] = &MountPoint{Destination: fmt.Sprintf("/mnt/%d", i)}
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, mount := range mounts {
+			mount.AppliedMiddleware = nil
+		}
+		if err := chain.AttachMounts(context.Background(), "bench-container", mounts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// restoreTestMiddleware is a minimal mountpoint.Middleware used to
+// exercise RestoreMounts without any real plugin RPC. Its
+// MountPointProperties response always reflects the current patterns
+// field, so a test can simulate a daemon restart that narrowed a
+// plugin's patterns out from under a previously attached mount.
+type restoreTestMiddleware struct {
+	name     string
+	patterns []mountpoint.MountPointPattern
+}
+
+func (m *restoreTestMiddleware) Name() string       { return m.name }
+func (m *restoreTestMiddleware) PluginName() string { return "" }
+func (m *restoreTestMiddleware) Digest() string     { return "" }
+
+func (m *restoreTestMiddleware) Patterns() []mountpoint.MountPointPattern {
+	return m.patterns
+}
+
+func (m *restoreTestMiddleware) MountPointProperties(*mountpoint.PropertiesRequest) (*mountpoint.PropertiesResponse, error) {
+	return &mountpoint.PropertiesResponse{Success: true, Patterns: m.patterns}, nil
+}
+
+func (m *restoreTestMiddleware) MountPointAttach(*mountpoint.AttachRequest) (*mountpoint.AttachResponse, error) {
+	return &mountpoint.AttachResponse{Success: true}, nil
+}
+
+func (m *restoreTestMiddleware) MountPointDetach(*mountpoint.DetachRequest) (*mountpoint.DetachResponse, error) {
+	return &mountpoint.DetachResponse{Success: true}, nil
+}
+
+func (m *restoreTestMiddleware) MountPointAttachContext(ctx context.Context, req *mountpoint.AttachRequest) (*mountpoint.AttachResponse, error) {
+	return m.MountPointAttach(req)
+}
+
+func (m *restoreTestMiddleware) MountPointDetachContext(ctx context.Context, req *mountpoint.DetachRequest) (*mountpoint.DetachResponse, error) {
+	return m.MountPointDetach(req)
+}
+
+func (m *restoreTestMiddleware) SpecModifiers() []func(*specs.Spec) error { return nil }
+
+// adoptingRestoreTestMiddleware wraps restoreTestMiddleware with a
+// configurable mountpoint.LiveRestorer hook.
+type adoptingRestoreTestMiddleware struct {
+	restoreTestMiddleware
+	adopt bool
+}
+
+func (m *adoptingRestoreTestMiddleware) LiveRestoreAttachment(mp *mountpoint.MountPoint, applied mountpoint.AppliedMiddleware) (bool, error) {
+	return m.adopt, nil
+}
+
+func TestResolvePropagatedMountJoinsWhenDeclared(t *testing.T) {
+	require.Equal(t, "/var/lib/docker/plugins/abc/rootfs/mnt/view/data", resolvePropagatedMount("/var/lib/docker/plugins/abc/rootfs/mnt/view", "/data"))
+}
+
+func TestResolvePropagatedMountPassesThroughWhenNotDeclared(t *testing.T) {
+	require.Equal(t, "/data", resolvePropagatedMount("", "/data"))
+}
+
+func TestResolvePropagatedMountPassesThroughEmptyEffectiveSource(t *testing.T) {
+	require.Equal(t, "", resolvePropagatedMount("/var/lib/docker/plugins/abc/rootfs/mnt/view", ""))
+}
+
+// propagatingTestMiddleware is a restoreTestMiddleware whose
+// MountPointProperties additionally reports a PropagatedMount, to
+// exercise AttachMounts resolving a v2 plugin's EffectiveSource against
+// it.
+type propagatingTestMiddleware struct {
+	restoreTestMiddleware
+	propagatedMount string
+}
+
+func (m *propagatingTestMiddleware) MountPointProperties(*mountpoint.PropertiesRequest) (*mountpoint.PropertiesResponse, error) {
+	return &mountpoint.PropertiesResponse{Success: true, Patterns: m.patterns, PropagatedMount: m.propagatedMount}, nil
+}
+
+func (m *propagatingTestMiddleware) MountPointAttach(*mountpoint.AttachRequest) (*mountpoint.AttachResponse, error) {
+	return &mountpoint.AttachResponse{
+		Success:     true,
+		Attachments: []mountpoint.Attachment{{Attach: true, Changes: mountpoint.Changes{EffectiveSource: "/view/data"}}},
+	}, nil
+}
+
+func (m *propagatingTestMiddleware) MountPointAttachContext(ctx context.Context, req *mountpoint.AttachRequest) (*mountpoint.AttachResponse, error) {
+	return m.MountPointAttach(req)
+}
+
+func TestAttachMountsResolvesEffectiveSourceAgainstPropagatedMount(t *testing.T) {
+	mw := &propagatingTestMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{name: "plugin:v2fs", patterns: []mountpoint.MountPointPattern{{}}},
+		propagatedMount:       "/var/lib/docker/plugins/abc/rootfs/mnt/view",
+	}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	mounts := []*MountPoint{{Destination: "/data"}}
+	require.Nil(t, chain.AttachMounts(context.Background(), "container1", mounts))
+	require.Equal(t, "/var/lib/docker/plugins/abc/rootfs/mnt/view/data", mounts[0].EffectiveSource())
+}
+
+// specModifyingTestMiddleware is a restoreTestMiddleware whose
+// SpecModifiers reports a configurable number of no-op modifiers, to
+// exercise AttachMounts/DetachMounts collecting and clearing them.
+type specModifyingTestMiddleware struct {
+	restoreTestMiddleware
+	n int
+}
+
+func (m *specModifyingTestMiddleware) SpecModifiers() []func(*specs.Spec) error {
+	modifiers := make([]func(*specs.Spec) error, m.n)
+	for i := range modifiers {
+		modifiers[i] = func(*specs.Spec) error { return nil }
+	}
+	return modifiers
+}
+
+func TestAttachMountsCollectsSpecModifiersFromSelectedMiddleware(t *testing.T) {
+	selected := &specModifyingTestMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{name: "plugin:specs", patterns: []mountpoint.MountPointPattern{{}}},
+		n:                     2,
+	}
+	unselected := &specModifyingTestMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{name: "plugin:unselected", patterns: []mountpoint.MountPointPattern{{Destination: []mountpoint.StringPattern{{Exactly: "/never"}}}}},
+		n:                     5,
+	}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{selected, unselected}}
+
+	mounts := []*MountPoint{{Destination: "/data"}}
+	require.Nil(t, chain.AttachMounts(context.Background(), "container1", mounts))
+	require.Len(t, chain.SpecModifiers("container1"), 2, "only the middleware selected for this container's mounts should contribute SpecModifiers")
+}
+
+// failingSpecModifyingTestMiddleware is a specModifyingTestMiddleware
+// whose MountPointAttach always fails, to exercise AttachMounts
+// clearing a stashed SpecModifiers entry on a failed attach rather than
+// leaking it for a later retry to duplicate.
+type failingSpecModifyingTestMiddleware struct {
+	specModifyingTestMiddleware
+}
+
+func (m *failingSpecModifyingTestMiddleware) MountPointAttach(*mountpoint.AttachRequest) (*mountpoint.AttachResponse, error) {
+	return &mountpoint.AttachResponse{Success: false, Err: "boom"}, nil
+}
+
+func TestAttachMountsClearsSpecModifiersOnFailure(t *testing.T) {
+	mw := &failingSpecModifyingTestMiddleware{
+		specModifyingTestMiddleware: specModifyingTestMiddleware{
+			restoreTestMiddleware: restoreTestMiddleware{name: "plugin:specs-fails", patterns: []mountpoint.MountPointPattern{{}}},
+			n:                     1,
+		},
+	}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	mounts := []*MountPoint{{Destination: "/data"}}
+	require.Error(t, chain.AttachMounts(context.Background(), "container1", mounts))
+	require.Nil(t, chain.SpecModifiers("container1"), "a failed attach must not leave a stashed SpecModifiers entry behind")
+
+	require.Error(t, chain.AttachMounts(context.Background(), "container1", mounts))
+	require.Nil(t, chain.SpecModifiers("container1"), "a retried failed attach must not duplicate the stashed entry either")
+}
+
+func TestDetachMountsClearsSpecModifiers(t *testing.T) {
+	mw := &specModifyingTestMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{name: "plugin:specs", patterns: []mountpoint.MountPointPattern{{}}},
+		n:                     1,
+	}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	mounts := []*MountPoint{{Destination: "/data"}}
+	require.Nil(t, chain.AttachMounts(context.Background(), "container1", mounts))
+	require.Len(t, chain.SpecModifiers("container1"), 1)
+
+	require.Nil(t, chain.DetachMounts(context.Background(), "container1", map[string]*MountPoint{"/data": mounts[0]}))
+	require.Nil(t, chain.SpecModifiers("container1"))
+}
+
+// optionReplacingTestMiddleware is a restoreTestMiddleware whose
+// MountPointAttach reports NewOptions/NewMode in its Attachment, to
+// exercise AttachMounts/EffectiveOptions/EffectiveMode.
+type optionReplacingTestMiddleware struct {
+	restoreTestMiddleware
+	newOptions map[string]string
+	newMode    string
+}
+
+func (m *optionReplacingTestMiddleware) MountPointAttach(*mountpoint.AttachRequest) (*mountpoint.AttachResponse, error) {
+	return &mountpoint.AttachResponse{
+		Success: true,
+		Attachments: []mountpoint.Attachment{
+			{Attach: true, Changes: mountpoint.Changes{NewOptions: m.newOptions, NewMode: m.newMode}},
+		},
+	}, nil
+}
+
+func TestAttachMountsMergesReplacedOptionsAndMode(t *testing.T) {
+	mw := &optionReplacingTestMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{name: "plugin:block", patterns: []mountpoint.MountPointPattern{{}}},
+		newOptions:            map[string]string{"device": "/dev/sdb1"},
+		newMode:               "ro",
+	}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	mounts := []*MountPoint{{Destination: "/data", Type: mounttypes.TypeBlock}}
+	require.Nil(t, chain.AttachMounts(context.Background(), "container1", mounts))
+	require.Equal(t, map[string]string{"device": "/dev/sdb1"}, mounts[0].EffectiveOptions())
+	require.Equal(t, "ro", mounts[0].EffectiveMode())
+}
+
+func TestNewChainFromRefsRejectsMismatchedAliasCount(t *testing.T) {
+	refs := make([]reference.Named, 2)
+	_, err := NewChainFromRefs(refs, []string{"only-one"}, nil)
+	require.Error(t, err, "aliases must either be nil or match refs 1:1")
+}
+
+func TestValidateMiddlewarePatternsRejectsBadRegex(t *testing.T) {
+	mw := &restoreTestMiddleware{
+		name:     "plugin:bad",
+		patterns: []mountpoint.MountPointPattern{{Source: []mountpoint.StringPattern{{Regex: "a("}}}},
+	}
+	require.Error(t, validateMiddlewarePatterns(mw))
+}
+
+func TestValidateMiddlewarePatternsAcceptsGoodPatterns(t *testing.T) {
+	mw := &restoreTestMiddleware{
+		name:     "plugin:good",
+		patterns: []mountpoint.MountPointPattern{{Source: []mountpoint.StringPattern{{Regex: "/var/.*"}}}},
+	}
+	require.Nil(t, validateMiddlewarePatterns(mw))
+}
+
+func TestValidPatternsForDropsPatternsThatFailToCompile(t *testing.T) {
+	mw := &restoreTestMiddleware{
+		name: "plugin:drifted",
+		patterns: []mountpoint.MountPointPattern{
+			{Source: []mountpoint.StringPattern{{Regex: "/var/.*"}}},
+			{Destination: []mountpoint.StringPattern{{Regex: "a("}}},
+		},
+	}
+	require.Equal(t, []mountpoint.MountPointPattern{mw.patterns[0]}, validPatternsFor(mw))
+}
+
+func TestValidPatternsForKeepsAllPatternsWhenEveryOneCompiles(t *testing.T) {
+	mw := &restoreTestMiddleware{
+		name: "plugin:fine",
+		patterns: []mountpoint.MountPointPattern{
+			{Source: []mountpoint.StringPattern{{Glob: "/var/**"}}},
+			{Destination: []mountpoint.StringPattern{{Regex: "/host/.*"}}},
+		},
+	}
+	require.Equal(t, mw.patterns, validPatternsFor(mw))
+}
+
+func TestRestoreMountsResolvesCoveringMiddleware(t *testing.T) {
+	mw := &restoreTestMiddleware{name: "plugin:covers", patterns: []mountpoint.MountPointPattern{{}}}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	mounts := []*MountPoint{{
+		Destination:       "/data",
+		AppliedMiddleware: []AppliedMountPointMiddleware{{Name: "plugin:covers", Clock: 1}},
+	}}
+
+	require.Nil(t, chain.RestoreMounts("container1", mounts))
+	require.Equal(t, 1, mounts[0].TopClock())
+}
+
+func TestRestoreMountsIgnoresPatternThatFailsToCompile(t *testing.T) {
+	mw := &restoreTestMiddleware{
+		name: "plugin:drifted",
+		patterns: []mountpoint.MountPointPattern{
+			{Destination: []mountpoint.StringPattern{{Regex: "a("}}},
+		},
+	}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	mounts := []*MountPoint{{
+		Destination:       "/data",
+		AppliedMiddleware: []AppliedMountPointMiddleware{{Name: "plugin:drifted", Clock: 1}},
+	}}
+
+	err := chain.RestoreMounts("container1", mounts)
+	require.IsType(t, &NonRecoverableAttachmentError{}, err, "an uncompilable pattern must not be treated as covering the mount")
+}
+
+func TestRestoreMountsMissingMiddleware(t *testing.T) {
+	chain := &MountPointChain{}
+	mounts := []*MountPoint{{
+		AppliedMiddleware: []AppliedMountPointMiddleware{{Name: "plugin:gone"}},
+	}}
+
+	err := chain.RestoreMounts("container1", mounts)
+	require.IsType(t, &MiddlewareNotFoundError{}, err)
+}
+
+func TestRestoreMountsNonCoveringMiddlewareWithoutLiveRestorerIsNonRecoverable(t *testing.T) {
+	mw := &restoreTestMiddleware{
+		name:     "plugin:narrowed",
+		patterns: []mountpoint.MountPointPattern{{Destination: []mountpoint.StringPattern{{Exactly: "/other"}}}},
+	}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	mounts := []*MountPoint{{
+		Destination:       "/data",
+		AppliedMiddleware: []AppliedMountPointMiddleware{{Name: "plugin:narrowed"}},
+	}}
+
+	err := chain.RestoreMounts("container1", mounts)
+	require.IsType(t, &NonRecoverableAttachmentError{}, err)
+}
+
+func TestRestoreMountsLiveRestorerCanAdoptAttachment(t *testing.T) {
+	mw := &adoptingRestoreTestMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{
+			name:     "plugin:narrowed",
+			patterns: []mountpoint.MountPointPattern{{Destination: []mountpoint.StringPattern{{Exactly: "/other"}}}},
+		},
+		adopt: true,
+	}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	mounts := []*MountPoint{{
+		Destination:       "/data",
+		AppliedMiddleware: []AppliedMountPointMiddleware{{Name: "plugin:narrowed"}},
+	}}
+
+	require.Nil(t, chain.RestoreMounts("container1", mounts))
+}
+
+// reconcilingTestMiddleware wraps restoreTestMiddleware with a
+// configurable mountpoint.Reconciler hook that returns decisions in
+// the order its mounts field records them being handed out.
+type reconcilingTestMiddleware struct {
+	restoreTestMiddleware
+	decisions []mountpoint.ReconcileAction
+	requests  []*mountpoint.ReconcileRequest
+}
+
+func (m *reconcilingTestMiddleware) MountPointReconcile(req *mountpoint.ReconcileRequest) (*mountpoint.ReconcileResponse, error) {
+	m.requests = append(m.requests, req)
+	return &mountpoint.ReconcileResponse{Success: true, Decisions: m.decisions}, nil
+}
+
+// MountPointAttach overrides restoreTestMiddleware's to report the
+// reattach as accepted, so TestReconcileMountsRedoReattachesWithSameClock
+// can assert ReconcileMounts pushed a new applied middleware back on.
+func (m *reconcilingTestMiddleware) MountPointAttach(req *mountpoint.AttachRequest) (*mountpoint.AttachResponse, error) {
+	attachments := make([]mountpoint.Attachment, len(req.Mounts))
+	for i := range req.Mounts {
+		attachments[i] = mountpoint.Attachment{Attach: true}
+	}
+	return &mountpoint.AttachResponse{Success: true, Attachments: attachments}, nil
+}
+
+func (m *reconcilingTestMiddleware) MountPointAttachContext(ctx context.Context, req *mountpoint.AttachRequest) (*mountpoint.AttachResponse, error) {
+	return m.MountPointAttach(req)
+}
+
+func TestReconcileMountsLeavesNonReconcilerMiddlewareUntouched(t *testing.T) {
+	mw := &restoreTestMiddleware{name: "plugin:static", patterns: []mountpoint.MountPointPattern{{}}}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	var iface mountpoint.Middleware = mw
+	mounts := []*MountPoint{{
+		Destination:       "/data",
+		AppliedMiddleware: []AppliedMountPointMiddleware{{Name: "plugin:static", Clock: 1, middleware: &iface}},
+	}}
+
+	require.Nil(t, chain.ReconcileMounts("container1", mounts))
+	require.Len(t, mounts[0].AppliedMiddleware, 1, "middleware not implementing Reconciler must be left untouched")
+}
+
+func TestReconcileMountsKeepLeavesAttachmentInPlace(t *testing.T) {
+	mw := &reconcilingTestMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{name: "plugin:keeper", patterns: []mountpoint.MountPointPattern{{}}},
+		decisions:             []mountpoint.ReconcileAction{mountpoint.ReconcileKeep},
+	}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	var iface mountpoint.Middleware = mw
+	mounts := []*MountPoint{{
+		Destination:       "/data",
+		AppliedMiddleware: []AppliedMountPointMiddleware{{Name: "plugin:keeper", Clock: 1, middleware: &iface}},
+	}}
+
+	require.Nil(t, chain.ReconcileMounts("container1", mounts))
+	require.Len(t, mounts[0].AppliedMiddleware, 1)
+	require.Equal(t, "plugin:keeper", mounts[0].AppliedMiddleware[0].Name)
+}
+
+func TestReconcileMountsDropRemovesAttachment(t *testing.T) {
+	mw := &reconcilingTestMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{name: "plugin:dropper", patterns: []mountpoint.MountPointPattern{{}}},
+		decisions:             []mountpoint.ReconcileAction{mountpoint.ReconcileDrop},
+	}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	var iface mountpoint.Middleware = mw
+	mounts := []*MountPoint{{
+		Destination:       "/data",
+		AppliedMiddleware: []AppliedMountPointMiddleware{{Name: "plugin:dropper", Clock: 1, middleware: &iface}},
+	}}
+
+	require.Nil(t, chain.ReconcileMounts("container1", mounts))
+	require.Len(t, mounts[0].AppliedMiddleware, 0, "a Drop decision must pop the middleware off the stack")
+}
+
+func TestReconcileMountsRedoReattachesWithSameClock(t *testing.T) {
+	mw := &reconcilingTestMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{name: "plugin:redoer", patterns: []mountpoint.MountPointPattern{{}}},
+		decisions:             []mountpoint.ReconcileAction{mountpoint.ReconcileRedo},
+	}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	var iface mountpoint.Middleware = mw
+	mounts := []*MountPoint{{
+		Destination:       "/data",
+		AppliedMiddleware: []AppliedMountPointMiddleware{{Name: "plugin:redoer", Clock: 3, middleware: &iface}},
+	}}
+
+	require.Nil(t, chain.ReconcileMounts("container1", mounts))
+	require.Len(t, mounts[0].AppliedMiddleware, 1, "a Redo decision must leave exactly one applied middleware after detach+reattach")
+	require.Equal(t, "plugin:redoer", mounts[0].AppliedMiddleware[0].Name)
+	require.Equal(t, 3, mounts[0].TopClock(), "Redo must preserve the original Clock so unwind ordering doesn't change")
+}
+
+func TestReconcileMountsRefusesToActWhenMiddlewareIsNotOnTop(t *testing.T) {
+	dropper := &reconcilingTestMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{name: "plugin:dropper", patterns: []mountpoint.MountPointPattern{{}}},
+		decisions:             []mountpoint.ReconcileAction{mountpoint.ReconcileDrop},
+	}
+	topper := &restoreTestMiddleware{name: "plugin:topper", patterns: []mountpoint.MountPointPattern{{}}}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{dropper, topper}}
+
+	var dropperIface mountpoint.Middleware = dropper
+	var topperIface mountpoint.Middleware = topper
+	mounts := []*MountPoint{{
+		Destination: "/data",
+		AppliedMiddleware: []AppliedMountPointMiddleware{
+			{Name: "plugin:dropper", Clock: 1, middleware: &dropperIface},
+			{Name: "plugin:topper", Clock: 2, middleware: &topperIface},
+		},
+	}}
+
+	err := chain.ReconcileMounts("container1", mounts)
+	require.Error(t, err)
+	require.Len(t, mounts[0].AppliedMiddleware, 2, "a refused reconcile must leave the stack exactly as it found it")
+}
+
+func TestRestoreMountsLiveRestorerCanDeclineAttachment(t *testing.T) {
+	mw := &adoptingRestoreTestMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{
+			name:     "plugin:narrowed",
+			patterns: []mountpoint.MountPointPattern{{Destination: []mountpoint.StringPattern{{Exactly: "/other"}}}},
+		},
+		adopt: false,
+	}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	mounts := []*MountPoint{{
+		Destination:       "/data",
+		AppliedMiddleware: []AppliedMountPointMiddleware{{Name: "plugin:narrowed"}},
+	}}
+
+	err := chain.RestoreMounts("container1", mounts)
+	require.IsType(t, &NonRecoverableAttachmentError{}, err)
+}
@@ -0,0 +1,154 @@
+package volume
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	middlewareAttachDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "mountpoint",
+		Subsystem: "middleware",
+		Name:      "attach_duration_seconds",
+		Help:      "Time taken for a mount point middleware attach RPC to complete.",
+	}, []string{"plugin"})
+
+	middlewareFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mountpoint",
+		Subsystem: "middleware",
+		Name:      "failures_total",
+		Help:      "Count of mount point middleware attach RPC failures and timeouts.",
+	}, []string{"plugin"})
+
+	middlewareCircuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "mountpoint",
+		Subsystem: "middleware",
+		Name:      "circuit_state",
+		Help:      "Current circuit breaker state per mount point middleware plugin (0=closed, 1=half-open, 2=open).",
+	}, []string{"plugin"})
+
+	middlewareInvalidPatternsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mountpoint",
+		Subsystem: "middleware",
+		Name:      "invalid_patterns_total",
+		Help:      "Count of patterns dropped because a mount point middleware's self-reported Patterns failed to compile (e.g. a malformed Regex or Glob).",
+	}, []string{"plugin"})
+)
+
+func init() {
+	prometheus.MustRegister(middlewareAttachDuration, middlewareFailuresTotal, middlewareCircuitState, middlewareInvalidPatternsTotal)
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitHalfOpen
+	circuitOpen
+)
+
+const (
+	// breakerFailureThreshold is the number of consecutive attach
+	// failures or timeouts after which a plugin's breaker opens.
+	breakerFailureThreshold = 5
+	// breakerOpenDuration is how long a breaker stays open before
+	// allowing a single half-open probe request through.
+	breakerOpenDuration = 30 * time.Second
+	// defaultMiddlewareAttachDeadline bounds how long the chain waits
+	// for a single plugin's attach/detach RPC when the daemon config
+	// doesn't set a per-plugin deadline.
+	defaultMiddlewareAttachDeadline = 30 * time.Second
+)
+
+// circuitBreaker tracks consecutive attach failures for a single
+// middleware plugin. After breakerFailureThreshold consecutive failures
+// within the plugin's deadline window it opens, and AttachMounts skips
+// (or hard-fails, depending on configuration) further requests to that
+// plugin until a half-open probe succeeds.
+type circuitBreaker struct {
+	mu              sync.Mutex
+	state           circuitState
+	consecutiveFail int
+	openedAt        time.Time
+}
+
+// allow reports whether a request should be sent to the plugin right
+// now. An open breaker transitions to half-open -- allowing exactly one
+// probe through -- once breakerOpenDuration has elapsed.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitOpen && time.Since(b.openedAt) >= breakerOpenDuration {
+		b.state = circuitHalfOpen
+	}
+	return b.state != circuitOpen
+}
+
+func (b *circuitBreaker) recordSuccess(name string) {
+	b.mu.Lock()
+	b.consecutiveFail = 0
+	b.state = circuitClosed
+	b.mu.Unlock()
+	middlewareCircuitState.WithLabelValues(name).Set(float64(circuitClosed))
+}
+
+func (b *circuitBreaker) recordFailure(name string) {
+	b.mu.Lock()
+	b.consecutiveFail++
+	if b.state == circuitHalfOpen || b.consecutiveFail >= breakerFailureThreshold {
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+	state := b.state
+	b.mu.Unlock()
+
+	middlewareFailuresTotal.WithLabelValues(name).Inc()
+	middlewareCircuitState.WithLabelValues(name).Set(float64(state))
+}
+
+// breakerFor returns the circuit breaker for the named middleware,
+// creating it on first use.
+func (c *MountPointChain) breakerFor(name string) *circuitBreaker {
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+	if c.breakers == nil {
+		c.breakers = make(map[string]*circuitBreaker)
+	}
+	b, ok := c.breakers[name]
+	if !ok {
+		b = &circuitBreaker{}
+		c.breakers[name] = b
+	}
+	return b
+}
+
+// deadlineFor returns the configured attach/detach deadline for the
+// named middleware, or defaultMiddlewareAttachDeadline if none was
+// configured for it.
+func (c *MountPointChain) deadlineFor(name string) time.Duration {
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+	if d, ok := c.deadlines[name]; ok {
+		return d
+	}
+	return defaultMiddlewareAttachDeadline
+}
+
+// SetMiddlewareDeadline overrides the attach/detach RPC deadline for a
+// specific middleware by name. Passing a zero duration reverts it to
+// defaultMiddlewareAttachDeadline.
+func (c *MountPointChain) SetMiddlewareDeadline(name string, deadline time.Duration) {
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+	if c.deadlines == nil {
+		c.deadlines = make(map[string]time.Duration)
+	}
+	if deadline == 0 {
+		delete(c.deadlines, name)
+		return
+	}
+	c.deadlines[name] = deadline
+}
@@ -0,0 +1,213 @@
+package volume
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/volume/mountpoint"
+)
+
+// journalEntry is the on-disk form of one AppliedMountPointMiddleware
+// stack entry: enough to both identify the middleware that needs to
+// detach (Name, Digest -- mirroring the same fields unwind already
+// checks against a live AppliedMountPointMiddleware) and to recreate
+// the Attachment/Clock a synthetic MountPoint needs for unwind to
+// replay in the original order.
+type journalEntry struct {
+	Name            string
+	Digest          string
+	EffectiveSource string
+	Clock           int
+}
+
+// journalRecord is the on-disk representation of one container's
+// in-flight AppliedMiddleware stacks at the end of the AttachMounts
+// call that wrote it, keyed by mount Destination.
+type journalRecord struct {
+	Mounts map[string][]journalEntry
+}
+
+// journalPath returns the on-disk path for containerID's journal file
+// under dir.
+func journalPath(dir, containerID string) string {
+	return filepath.Join(dir, containerID+".json")
+}
+
+// writeJournal atomically (write-temp-then-rename) persists record for
+// containerID under dir, so a daemon crash mid-write never leaves a
+// corrupt journal file for Recover to choke on.
+func writeJournal(dir, containerID string, record journalRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	path := journalPath(dir, containerID)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readJournal loads containerID's journal file from dir.
+func readJournal(dir, containerID string) (journalRecord, error) {
+	b, err := ioutil.ReadFile(journalPath(dir, containerID))
+	if err != nil {
+		return journalRecord{}, err
+	}
+	var record journalRecord
+	if err := json.Unmarshal(b, &record); err != nil {
+		return journalRecord{}, err
+	}
+	return record, nil
+}
+
+// removeJournal deletes containerID's journal file under dir, if any.
+func removeJournal(dir, containerID string) error {
+	err := os.Remove(journalPath(dir, containerID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SetJournalDir points the chain at dir (a subdirectory of the daemon
+// root) to persist the crash-recovery journal AttachMounts/DetachMounts
+// maintain and Recover replays. Passing the empty string disables
+// journaling -- AttachMounts/DetachMounts then behave exactly as before
+// this feature existed.
+func (c *MountPointChain) SetJournalDir(dir string) {
+	c.journalDir = dir
+}
+
+// writeJournalForContainer persists containerID's current
+// AppliedMiddleware stacks (across all of mounts) to the journal,
+// replacing whatever was recorded for it before. A container with no
+// middleware applied to any of its mounts has its journal entry (if
+// any) removed instead, so Recover never trips over a stale empty
+// record.
+func (c *MountPointChain) writeJournalForContainer(containerID string, mounts []*MountPoint) error {
+	record := journalRecord{Mounts: map[string][]journalEntry{}}
+	for _, mp := range mounts {
+		if len(mp.AppliedMiddleware) == 0 {
+			continue
+		}
+		entries := make([]journalEntry, len(mp.AppliedMiddleware))
+		for i, applied := range mp.AppliedMiddleware {
+			entries[i] = journalEntry{
+				Name:            applied.Name,
+				Digest:          applied.Digest,
+				EffectiveSource: applied.Attachment.EffectiveSource,
+				Clock:           applied.Clock,
+			}
+		}
+		record.Mounts[mp.Destination] = entries
+	}
+
+	if len(record.Mounts) == 0 {
+		return removeJournal(c.journalDir, containerID)
+	}
+	return writeJournal(c.journalDir, containerID, record)
+}
+
+// Recover replays the on-disk journal against every container recorded
+// in it that isn't in liveContainerIDs (the set the daemon's container
+// store restored on this start), so a crash between AttachMounts and
+// DetachMounts doesn't orphan plugin-side state (mounted overlays,
+// allocated keys, external mounts) forever. The daemon should call this
+// once, after container restore completes, with the IDs of every
+// container it kept running (including live-restored ones, whose
+// mounts RestoreMounts/ReconcileMounts already accounted for).
+//
+// A container whose recovery fails -- e.g. because it has a recorded
+// AppliedMiddleware entry whose plugin no longer resolves -- is logged
+// in the returned error and skipped rather than aborting the rest of
+// recovery; its journal entry is left in place for a later Recover call
+// once the plugin is available again.
+func (c *MountPointChain) Recover(liveContainerIDs []string) error {
+	if c.journalDir == "" {
+		return nil
+	}
+
+	live := make(map[string]bool, len(liveContainerIDs))
+	for _, id := range liveContainerIDs {
+		live[id] = true
+	}
+
+	files, err := ioutil.ReadDir(c.journalDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var errs []string
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		containerID := strings.TrimSuffix(f.Name(), ".json")
+		if live[containerID] {
+			continue
+		}
+
+		if err := c.recoverContainer(containerID); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", containerID, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("mount point journal recovery: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// recoverContainer rebuilds synthetic MountPoints from containerID's
+// journal record -- detach only needs each mount's AppliedMiddleware
+// stack, not its Source/Destination/Driver -- drops any recorded
+// middleware that no longer resolves against the current plugin set,
+// and unwinds the rest through the same c.unwind path AttachMounts'
+// failure handling and DetachMounts already use.
+func (c *MountPointChain) recoverContainer(containerID string) error {
+	record, err := readJournal(c.journalDir, containerID)
+	if err != nil {
+		return err
+	}
+
+	mounts := make([]*MountPoint, 0, len(record.Mounts))
+	for destination, entries := range record.Mounts {
+		mp := &MountPoint{Destination: destination}
+		for _, entry := range entries {
+			mp.AppliedMiddleware = append(mp.AppliedMiddleware, AppliedMountPointMiddleware{
+				Name:       entry.Name,
+				Digest:     entry.Digest,
+				Attachment: mountpoint.MountPointAttachment{EffectiveSource: entry.EffectiveSource},
+				Clock:      entry.Clock,
+			})
+		}
+		mounts = append(mounts, mp)
+	}
+
+	for _, mp := range mounts {
+		resolved := mp.AppliedMiddleware[:0]
+		for _, applied := range mp.AppliedMiddleware {
+			if _, err := applied.Middleware(); err != nil {
+				continue
+			}
+			resolved = append(resolved, applied)
+		}
+		mp.AppliedMiddleware = resolved
+	}
+
+	if err := c.unwind(context.Background(), containerID, mounts); err != nil {
+		return err
+	}
+	return removeJournal(c.journalDir, containerID)
+}
@@ -0,0 +1,122 @@
+package volume
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/docker/docker/volume/mountpoint"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalRoundTrips(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mountpoint-journal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	record := journalRecord{Mounts: map[string][]journalEntry{
+		"/data": {{Name: "plugin:journal-a", Digest: "sha256:abc", EffectiveSource: "/view/data", Clock: 1}},
+	}}
+	require.NoError(t, writeJournal(dir, "container1", record))
+
+	got, err := readJournal(dir, "container1")
+	require.NoError(t, err)
+	require.Equal(t, record, got)
+
+	require.NoError(t, removeJournal(dir, "container1"))
+	_, err = readJournal(dir, "container1")
+	require.Error(t, err)
+}
+
+func TestRemoveJournalToleratesMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mountpoint-journal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, removeJournal(dir, "never-existed"))
+}
+
+func TestWriteJournalForContainerRemovesRecordWhenNoMiddlewareApplied(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mountpoint-journal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := &MountPointChain{journalDir: dir}
+	require.NoError(t, c.writeJournalForContainer("container1", []*MountPoint{{Destination: "/data"}}))
+
+	_, err = readJournal(dir, "container1")
+	require.Error(t, err, "a container with no applied middleware shouldn't leave a journal entry behind")
+}
+
+func TestMountPointChainAttachMountsWritesAndDetachMountsRemovesJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mountpoint-journal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mw := &restoreTestMiddleware{name: "plugin:journal-live", patterns: []mountpoint.MountPointPattern{{}}}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}, journalDir: dir}
+
+	mounts := []*MountPoint{{Destination: "/data"}}
+	require.NoError(t, chain.AttachMounts(context.Background(), "container1", mounts))
+
+	record, err := readJournal(dir, "container1")
+	require.NoError(t, err)
+	require.Len(t, record.Mounts["/data"], 1)
+	require.Equal(t, "plugin:journal-live", record.Mounts["/data"][0].Name)
+
+	require.NoError(t, chain.DetachMounts(context.Background(), "container1", map[string]*MountPoint{"/data": mounts[0]}))
+	_, err = readJournal(dir, "container1")
+	require.Error(t, err, "DetachMounts should remove the journal entry once unwind succeeds")
+}
+
+func TestRecoverSkipsLiveContainers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mountpoint-journal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	record := journalRecord{Mounts: map[string][]journalEntry{
+		"/data": {{Name: "plugin:journal-missing", Clock: 1}},
+	}}
+	require.NoError(t, writeJournal(dir, "live-container", record))
+
+	chain := &MountPointChain{journalDir: dir}
+	require.NoError(t, chain.Recover([]string{"live-container"}))
+
+	_, err = readJournal(dir, "live-container")
+	require.NoError(t, err, "a live container's journal entry must be left untouched for DetachMounts to remove later")
+}
+
+func TestRecoverUnwindsNonLiveContainer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mountpoint-journal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	mw := &restoreTestMiddleware{name: "plugin:journal-recover", patterns: []mountpoint.MountPointPattern{{}}}
+	registerStaticMiddleware("plugin:journal-recover", mw)
+
+	record := journalRecord{Mounts: map[string][]journalEntry{
+		"/data": {{Name: "plugin:journal-recover", Clock: 1}},
+	}}
+	require.NoError(t, writeJournal(dir, "crashed-container", record))
+
+	chain := &MountPointChain{journalDir: dir}
+	require.NoError(t, chain.Recover(nil))
+
+	_, err = readJournal(dir, "crashed-container")
+	require.Error(t, err, "Recover should detach and remove the journal entry for a non-live container")
+}
+
+func TestRecoverToleratesUnresolvableMiddleware(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mountpoint-journal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	record := journalRecord{Mounts: map[string][]journalEntry{
+		"/data": {{Name: "plugin:journal-does-not-exist", Clock: 1}},
+	}}
+	require.NoError(t, writeJournal(dir, "crashed-container", record))
+
+	chain := &MountPointChain{journalDir: dir}
+	require.NoError(t, chain.Recover(nil), "an unresolvable middleware should be dropped, not fail the whole recovery")
+}
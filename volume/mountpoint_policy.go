@@ -0,0 +1,108 @@
+package volume
+
+import (
+	"time"
+
+	"github.com/docker/docker/volume/mountpoint"
+)
+
+// defaultMiddlewareDetachDeadline bounds how long the chain waits for a
+// single plugin's detach RPC when no MiddlewarePolicy.DetachTimeout has
+// been configured for it.
+const defaultMiddlewareDetachDeadline = 30 * time.Second
+
+// MiddlewarePolicy bundles the per-plugin failure-isolation settings a
+// daemon config ("mount-point-middleware" entry, see
+// StaticMiddlewareConfig) or SetMiddlewarePolicy caller can tune:
+// attach/detach RPC deadlines and how many times to retry an attach
+// before giving up. Detach is never retried here -- a failed detach's
+// Recoverable flag (see unwind) already tells the chain whether it's
+// safe to keep unwinding, and retrying a detach the plugin considers
+// unrecoverable would just delay surfacing that to the caller.
+type MiddlewarePolicy struct {
+	// AttachTimeout bounds a single attach RPC attempt. Zero means
+	// defaultMiddlewareAttachDeadline.
+	AttachTimeout time.Duration
+	// DetachTimeout bounds a single detach RPC attempt. Zero means
+	// defaultMiddlewareDetachDeadline.
+	DetachTimeout time.Duration
+	// MaxRetries is how many additional attempts attachMiddlewareBatch
+	// makes after an attach RPC fails or times out, with exponential
+	// backoff between attempts. Attach is idempotent from the chain's
+	// point of view -- a retried attach simply re-requests the same
+	// AttachRequest -- which is why only attach, not detach, retries.
+	MaxRetries int
+}
+
+// SetMiddlewarePolicy overrides the attach/detach deadlines and attach
+// retry count for a specific middleware by name. Passing the zero
+// MiddlewarePolicy reverts it to the package defaults.
+func (c *MountPointChain) SetMiddlewarePolicy(name string, policy MiddlewarePolicy) {
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+	if c.policies == nil {
+		c.policies = make(map[string]MiddlewarePolicy)
+	}
+	if policy == (MiddlewarePolicy{}) {
+		delete(c.policies, name)
+		return
+	}
+	c.policies[name] = policy
+}
+
+// policyFor returns the configured MiddlewarePolicy for name with every
+// zero-valued field filled in. An admin-configured MiddlewarePolicy
+// (SetMiddlewarePolicy) or legacy deadline always wins; failing that,
+// mw's own advertised AttachTimeout/DetachTimeout (see
+// advertisedTimeoutsFor) is used; failing that, the package default.
+func (c *MountPointChain) policyFor(name string, mw mountpoint.Middleware) MiddlewarePolicy {
+	c.breakersMu.Lock()
+	policy := c.policies[name]
+	deadline, hasDeadline := c.deadlines[name]
+	c.breakersMu.Unlock()
+
+	needAttach := policy.AttachTimeout == 0 && !hasDeadline
+	needDetach := policy.DetachTimeout == 0
+	var advertisedAttach, advertisedDetach time.Duration
+	if needAttach || needDetach {
+		advertisedAttach, advertisedDetach = advertisedTimeoutsFor(mw)
+	}
+
+	if policy.AttachTimeout == 0 {
+		switch {
+		case hasDeadline:
+			policy.AttachTimeout = deadline
+		case advertisedAttach != 0:
+			policy.AttachTimeout = advertisedAttach
+		default:
+			policy.AttachTimeout = defaultMiddlewareAttachDeadline
+		}
+	}
+	if policy.DetachTimeout == 0 {
+		if advertisedDetach != 0 {
+			policy.DetachTimeout = advertisedDetach
+		} else {
+			policy.DetachTimeout = defaultMiddlewareDetachDeadline
+		}
+	}
+	return policy
+}
+
+// advertisedTimeoutsFor re-queries mw's properties for any
+// AttachTimeout/DetachTimeout it advertises, discarding any error the
+// same best-effort way propagatedMountFor does -- an unreachable plugin
+// is treated as advertising neither.
+func advertisedTimeoutsFor(mw mountpoint.Middleware) (attach, detach time.Duration) {
+	response, err := mw.MountPointProperties(&mountpoint.PropertiesRequest{})
+	if err != nil || !response.Success {
+		return 0, 0
+	}
+	return response.AttachTimeout, response.DetachTimeout
+}
+
+// backoffDuration returns how long to wait before retry attempt n
+// (1-indexed: the first retry after the initial attempt), doubling a
+// 100ms base each attempt.
+func backoffDuration(attempt int) time.Duration {
+	return 100 * time.Millisecond * time.Duration(uint64(1)<<uint(attempt-1))
+}
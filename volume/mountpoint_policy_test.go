@@ -0,0 +1,210 @@
+package volume
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/volume/mountpoint"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyAttachMiddleware fails its first failThenSucceed attach attempts
+// and succeeds thereafter, so AttachMounts' retry loop can be exercised
+// without any real plugin RPC.
+type flakyAttachMiddleware struct {
+	restoreTestMiddleware
+	failThenSucceed int32
+	attempts        int32
+}
+
+func (m *flakyAttachMiddleware) MountPointAttachContext(ctx context.Context, req *mountpoint.AttachRequest) (*mountpoint.AttachResponse, error) {
+	if atomic.AddInt32(&m.attempts, 1) <= m.failThenSucceed {
+		return &mountpoint.AttachResponse{Success: false, Err: "transient failure"}, nil
+	}
+	attachments := make([]mountpoint.Attachment, len(req.Mounts))
+	for i := range req.Mounts {
+		attachments[i] = mountpoint.Attachment{Attach: true}
+	}
+	return &mountpoint.AttachResponse{Success: true, Attachments: attachments}, nil
+}
+
+func TestAttachMountsRetriesAttachUntilSuccess(t *testing.T) {
+	mw := &flakyAttachMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{name: "plugin:flaky", patterns: []mountpoint.MountPointPattern{{}}},
+		failThenSucceed:       2,
+	}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+	chain.SetMiddlewarePolicy("plugin:flaky", MiddlewarePolicy{MaxRetries: 3})
+
+	mounts := []*MountPoint{{Destination: "/data"}}
+	require.Nil(t, chain.AttachMounts(context.Background(), "container1", mounts))
+	require.Equal(t, int32(3), atomic.LoadInt32(&mw.attempts))
+}
+
+func TestAttachMountsGivesUpAfterMaxRetries(t *testing.T) {
+	mw := &flakyAttachMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{name: "plugin:flaky", patterns: []mountpoint.MountPointPattern{{}}},
+		failThenSucceed:       5,
+	}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+	chain.SetMiddlewarePolicy("plugin:flaky", MiddlewarePolicy{MaxRetries: 1})
+
+	mounts := []*MountPoint{{Destination: "/data"}}
+	require.Error(t, chain.AttachMounts(context.Background(), "container1", mounts))
+	require.Equal(t, int32(2), atomic.LoadInt32(&mw.attempts))
+}
+
+// deadlineProbeMiddleware records the deadline duration remaining on the
+// context it's given for MountPointDetachContext, so a test can confirm
+// policyFor's DetachTimeout actually reaches the RPC call.
+type deadlineProbeMiddleware struct {
+	restoreTestMiddleware
+	observed time.Duration
+}
+
+func (m *deadlineProbeMiddleware) MountPointDetachContext(ctx context.Context, req *mountpoint.DetachRequest) (*mountpoint.DetachResponse, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		m.observed = time.Until(deadline)
+	}
+	return &mountpoint.DetachResponse{Success: true}, nil
+}
+
+func TestUnwindUsesConfiguredDetachTimeout(t *testing.T) {
+	mw := &deadlineProbeMiddleware{restoreTestMiddleware: restoreTestMiddleware{name: "plugin:detach-probe"}}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+	chain.SetMiddlewarePolicy("plugin:detach-probe", MiddlewarePolicy{DetachTimeout: time.Hour})
+
+	var middleware mountpoint.Middleware = mw
+	mounts := map[string]*MountPoint{
+		"data": {
+			Destination:       "/data",
+			AppliedMiddleware: []AppliedMountPointMiddleware{{Name: "plugin:detach-probe", middleware: &middleware, Clock: 1}},
+		},
+	}
+
+	require.Nil(t, chain.DetachMounts(context.Background(), "container1", mounts))
+	require.True(t, mw.observed > 30*time.Minute, "expected the configured one-hour deadline, got %s", mw.observed)
+}
+
+// failingDetachMiddleware always fails MountPointDetachContext with a
+// configurable Recoverable flag, so unwind's halt-vs-continue branch can
+// be exercised directly.
+type failingDetachMiddleware struct {
+	restoreTestMiddleware
+	recoverable bool
+}
+
+func (m *failingDetachMiddleware) MountPointDetachContext(ctx context.Context, req *mountpoint.DetachRequest) (*mountpoint.DetachResponse, error) {
+	return &mountpoint.DetachResponse{Success: false, Recoverable: m.recoverable, Err: "boom"}, nil
+}
+
+func TestUnwindHaltsOnNonRecoverableDetachFailure(t *testing.T) {
+	mw := &failingDetachMiddleware{restoreTestMiddleware: restoreTestMiddleware{name: "plugin:fails-detach"}, recoverable: false}
+	var middleware mountpoint.Middleware = mw
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	mounts := map[string]*MountPoint{
+		"data": {
+			Destination:       "/data",
+			AppliedMiddleware: []AppliedMountPointMiddleware{{Name: "plugin:fails-detach", middleware: &middleware, Clock: 1}},
+		},
+	}
+
+	err := chain.DetachMounts(context.Background(), "container1", mounts)
+	require.Error(t, err)
+	require.Equal(t, 1, len(mounts["data"].AppliedMiddleware), "a non-recoverable failure must leave the unpopped stack intact for the caller to retry")
+}
+
+// timeoutAdvertisingMiddleware is a restoreTestMiddleware whose
+// MountPointProperties additionally reports AttachTimeout/DetachTimeout,
+// to exercise policyFor falling back to a plugin's own advertised
+// timeouts when the admin hasn't configured a MiddlewarePolicy.
+type timeoutAdvertisingMiddleware struct {
+	restoreTestMiddleware
+	attachTimeout time.Duration
+	detachTimeout time.Duration
+}
+
+func (m *timeoutAdvertisingMiddleware) MountPointProperties(*mountpoint.PropertiesRequest) (*mountpoint.PropertiesResponse, error) {
+	return &mountpoint.PropertiesResponse{
+		Success:       true,
+		Patterns:      m.patterns,
+		AttachTimeout: m.attachTimeout,
+		DetachTimeout: m.detachTimeout,
+	}, nil
+}
+
+func TestPolicyForUsesPluginAdvertisedTimeoutsWhenUnconfigured(t *testing.T) {
+	mw := &timeoutAdvertisingMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{name: "plugin:advertises-timeout"},
+		attachTimeout:         5 * time.Minute,
+		detachTimeout:         7 * time.Minute,
+	}
+	chain := &MountPointChain{}
+
+	policy := chain.policyFor("plugin:advertises-timeout", mw)
+	require.Equal(t, 5*time.Minute, policy.AttachTimeout)
+	require.Equal(t, 7*time.Minute, policy.DetachTimeout)
+}
+
+func TestPolicyForPrefersExplicitOverrideOverAdvertisedTimeout(t *testing.T) {
+	mw := &timeoutAdvertisingMiddleware{
+		restoreTestMiddleware: restoreTestMiddleware{name: "plugin:advertises-timeout"},
+		attachTimeout:         5 * time.Minute,
+	}
+	chain := &MountPointChain{}
+	chain.SetMiddlewarePolicy("plugin:advertises-timeout", MiddlewarePolicy{AttachTimeout: time.Minute})
+
+	policy := chain.policyFor("plugin:advertises-timeout", mw)
+	require.Equal(t, time.Minute, policy.AttachTimeout, "an admin-configured override always wins over a plugin's advertised timeout")
+}
+
+// cancelAwareAttachMiddleware reports the context it's given to
+// MountPointAttachContext as failed, the way a real plugin transport
+// would once the chain's deadline (derived from the caller's ctx) trips.
+type cancelAwareAttachMiddleware struct {
+	restoreTestMiddleware
+}
+
+func (m *cancelAwareAttachMiddleware) MountPointAttachContext(ctx context.Context, req *mountpoint.AttachRequest) (*mountpoint.AttachResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	attachments := make([]mountpoint.Attachment, len(req.Mounts))
+	for i := range req.Mounts {
+		attachments[i] = mountpoint.Attachment{Attach: true}
+	}
+	return &mountpoint.AttachResponse{Success: true, Attachments: attachments}, nil
+}
+
+func TestAttachMountsFailsAndUnwindsWhenCallerContextIsAlreadyCanceled(t *testing.T) {
+	mw := &cancelAwareAttachMiddleware{restoreTestMiddleware: restoreTestMiddleware{name: "plugin:cancel-aware", patterns: []mountpoint.MountPointPattern{{}}}}
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	mounts := []*MountPoint{{Destination: "/data"}}
+	err := chain.AttachMounts(ctx, "container1", mounts)
+	require.Error(t, err)
+	require.Empty(t, mounts[0].AppliedMiddleware, "a caller-canceled context must not leave a middleware attached")
+}
+
+func TestUnwindContinuesPastRecoverableDetachFailure(t *testing.T) {
+	mw := &failingDetachMiddleware{restoreTestMiddleware: restoreTestMiddleware{name: "plugin:fails-detach"}, recoverable: true}
+	var middleware mountpoint.Middleware = mw
+	chain := &MountPointChain{middleware: []mountpoint.Middleware{mw}}
+
+	mounts := map[string]*MountPoint{
+		"data": {
+			Destination:       "/data",
+			AppliedMiddleware: []AppliedMountPointMiddleware{{Name: "plugin:fails-detach", middleware: &middleware, Clock: 1}},
+		},
+	}
+
+	err := chain.DetachMounts(context.Background(), "container1", mounts)
+	require.Error(t, err, "the accumulated error is still surfaced even though unwind finished")
+	require.Equal(t, 0, len(mounts["data"].AppliedMiddleware), "a recoverable failure still pops the stack and keeps unwinding")
+}
@@ -0,0 +1,128 @@
+package volume
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/docker/docker/pkg/plugingetter"
+	"github.com/docker/docker/volume/mountpoint"
+)
+
+// StaticMiddlewareConfig is one entry of a daemon.json
+// "mount-point-middleware" section: a plugin binding the operator
+// declares directly, following the static connector/middleware pattern
+// used by identity daemons, instead of trusting the plugin's
+// self-reported Patterns from PropertiesRequest. daemon/config doesn't
+// exist in this source tree to parse the daemon.json section itself;
+// this is the struct its loader would construct one of per entry and
+// hand to SetStaticMiddleware.
+type StaticMiddlewareConfig struct {
+	// Plugin is the plugin name to resolve against the plugin getter.
+	Plugin string
+	// Alias lets the same Plugin appear more than once in the stack
+	// under different Patterns/Priority. Defaults to Plugin.
+	Alias string
+	// Patterns overrides the DNF pattern set the plugin reports from
+	// PropertiesRequest, so an admin can narrow or repurpose a plugin's
+	// selection without the plugin author's cooperation.
+	Patterns []mountpoint.MountPointPattern
+	// Priority orders this entry relative to other static entries:
+	// lower values run earlier in the chain. Entries with equal
+	// Priority keep their daemon.json order.
+	Priority int
+}
+
+// staticMiddlewareByAlias lets AppliedMountPointMiddleware.Middleware()
+// resolve a persisted alias back to the exact middleware object
+// SetStaticMiddleware built for it (Patterns overrides and all), rather
+// than falling back to a vanilla plugin lookup that would lose the
+// override.
+var (
+	staticMiddlewareMu      sync.Mutex
+	staticMiddlewareByAlias map[string]mountpoint.Middleware
+)
+
+func registerStaticMiddleware(name string, m mountpoint.Middleware) {
+	staticMiddlewareMu.Lock()
+	defer staticMiddlewareMu.Unlock()
+	if staticMiddlewareByAlias == nil {
+		staticMiddlewareByAlias = map[string]mountpoint.Middleware{}
+	}
+	staticMiddlewareByAlias[name] = m
+}
+
+func lookupStaticMiddleware(name string) (mountpoint.Middleware, bool) {
+	staticMiddlewareMu.Lock()
+	defer staticMiddlewareMu.Unlock()
+	m, ok := staticMiddlewareByAlias[name]
+	return m, ok
+}
+
+// staticMiddleware wraps a resolved plugin middleware so it reports the
+// daemon.json-declared alias as its Name() and the daemon.json-declared
+// Patterns instead of the plugin's own PropertiesRequest response.
+type staticMiddleware struct {
+	mountpoint.Middleware
+	alias    string
+	patterns []mountpoint.MountPointPattern
+}
+
+func (s staticMiddleware) Name() string {
+	return s.alias
+}
+
+func (s staticMiddleware) Patterns() []mountpoint.MountPointPattern {
+	return s.patterns
+}
+
+// SetStaticMiddleware resolves and registers the daemon.json
+// "mount-point-middleware" entries into the chain, in ascending
+// Priority order (ties keep their configs order), replacing any
+// middleware the chain previously held. Each entry's patterns are
+// validated the same way a plugin-API registration is in
+// resolvePluginRefs, so a malformed Regex/Glob in daemon.json is
+// rejected at daemon start rather than at the first matching mount.
+func (c *MountPointChain) SetStaticMiddleware(configs []StaticMiddlewareConfig, pg plugingetter.PluginGetter) error {
+	mountpoint.SetPluginGetter(pg)
+
+	ordered := make([]StaticMiddlewareConfig, len(configs))
+	copy(ordered, configs)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Priority < ordered[j].Priority
+	})
+
+	plainNames := make([]string, len(ordered))
+	for i, cfg := range ordered {
+		plainNames[i] = cfg.Plugin
+	}
+
+	plugins, err := mountpoint.NewPlugins(plainNames)
+	if err != nil {
+		return err
+	}
+
+	middleware := make([]mountpoint.Middleware, len(ordered))
+	for i, cfg := range ordered {
+		alias := cfg.Alias
+		if alias == "" {
+			alias = cfg.Plugin
+		}
+
+		var m mountpoint.Middleware = plugins[i]
+		aliasName := "plugin:" + alias
+		m = staticMiddleware{Middleware: m, alias: aliasName, patterns: cfg.Patterns}
+
+		if err := validateMiddlewarePatterns(m); err != nil {
+			return fmt.Errorf("mount point middleware %s: %s", aliasName, err)
+		}
+
+		registerStaticMiddleware(aliasName, m)
+		middleware[i] = m
+	}
+
+	c.mu.Lock()
+	c.middleware = middleware
+	c.mu.Unlock()
+	return nil
+}
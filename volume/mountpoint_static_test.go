@@ -0,0 +1,30 @@
+package volume
+
+import (
+	"testing"
+
+	"github.com/docker/docker/volume/mountpoint"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticMiddlewareOverridesNameAndPatterns(t *testing.T) {
+	override := []mountpoint.MountPointPattern{{Destination: []mountpoint.StringPattern{{PathPrefix: "/secrets"}}}}
+	m := staticMiddleware{
+		Middleware: &restoreTestMiddleware{name: "plugin:quota", patterns: []mountpoint.MountPointPattern{{}}},
+		alias:      "plugin:secrets-quota",
+		patterns:   override,
+	}
+
+	require.Equal(t, "plugin:secrets-quota", m.Name())
+	require.Equal(t, override, m.Patterns())
+}
+
+func TestAppliedMountPointMiddlewareResolvesStaticAlias(t *testing.T) {
+	var m mountpoint.Middleware = &restoreTestMiddleware{name: "plugin:secrets-quota"}
+	registerStaticMiddleware("plugin:secrets-quota", m)
+
+	applied := AppliedMountPointMiddleware{Name: "plugin:secrets-quota"}
+	resolved, err := applied.Middleware()
+	require.Nil(t, err)
+	require.Equal(t, m, *resolved)
+}
@@ -0,0 +1,58 @@
+package policy
+
+import (
+	"context"
+
+	"github.com/docker/docker/volume/mountpoint"
+)
+
+// NativeRule pairs a named MountPointPattern with the action to take
+// when it matches a candidate mount point.
+type NativeRule struct {
+	Name    string
+	Pattern mountpoint.MountPointPattern
+	Action  Action
+}
+
+// NativeEngine is the Engine backend built directly on
+// mountpoint.MountPointPattern. Rules are evaluated in order and the
+// first match decides the outcome; a mount point matching no rule is
+// allowed, matching the permissive-by-default convention the rest of
+// this pattern matching already follows.
+type NativeEngine struct {
+	rules []compiledNativeRule
+}
+
+type compiledNativeRule struct {
+	NativeRule
+	compiled *mountpoint.CompiledPattern
+}
+
+// NewNativeEngine compiles every rule's pattern up front, so Evaluate
+// doesn't pay compile cost per mount request.
+func NewNativeEngine(rules []NativeRule) (*NativeEngine, error) {
+	compiled := make([]compiledNativeRule, len(rules))
+	for i, r := range rules {
+		c, err := mountpoint.Compile(r.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled[i] = compiledNativeRule{NativeRule: r, compiled: c}
+	}
+	return &NativeEngine{rules: compiled}, nil
+}
+
+// Evaluate returns the first matching rule's Decision, or an allow
+// Decision with no matched rule if nothing matches.
+func (e *NativeEngine) Evaluate(ctx context.Context, mount *mountpoint.MountPoint) (Decision, error) {
+	for _, r := range e.rules {
+		if r.compiled.Matches(mount) {
+			return Decision{
+				Allowed: r.Action != ActionDeny,
+				Rule:    r.Name,
+				Actions: []Action{r.Action},
+			}, nil
+		}
+	}
+	return Decision{Allowed: true}, nil
+}
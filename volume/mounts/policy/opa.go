@@ -0,0 +1,70 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker/docker/volume/mountpoint"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// OPAEngine evaluates a candidate MountPoint against a compiled Rego
+// query. The MountPoint is marshalled to JSON and passed as the query
+// input; the query is expected to produce a single result shaped like
+// {"allow": bool, "rule": string, "reason": string}.
+type OPAEngine struct {
+	query rego.PreparedEvalQuery
+}
+
+// NewOPAEngine prepares a Rego query from regoModule under the given
+// query path (e.g. "data.docker.mounts.decision").
+func NewOPAEngine(ctx context.Context, regoModule, queryPath string) (*OPAEngine, error) {
+	prepared, err := rego.New(
+		rego.Query(queryPath),
+		rego.Module("policy.rego", regoModule),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("policy: preparing rego query: %s", err)
+	}
+	return &OPAEngine{query: prepared}, nil
+}
+
+// opaResult is the expected shape of the Rego query's result.
+type opaResult struct {
+	Allow  bool   `json:"allow"`
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+// Evaluate marshals mount to JSON as the query input and interprets the
+// first result as an opaResult.
+func (e *OPAEngine) Evaluate(ctx context.Context, mount *mountpoint.MountPoint) (Decision, error) {
+	encoded, err := json.Marshal(mount)
+	if err != nil {
+		return Decision{}, err
+	}
+	var input interface{}
+	if err := json.Unmarshal(encoded, &input); err != nil {
+		return Decision{}, err
+	}
+
+	results, err := e.query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return Decision{}, fmt.Errorf("policy: evaluating rego query: %s", err)
+	}
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return Decision{}, fmt.Errorf("policy: rego query produced no result")
+	}
+
+	encodedResult, err := json.Marshal(results[0].Expressions[0].Value)
+	if err != nil {
+		return Decision{}, err
+	}
+	var result opaResult
+	if err := json.Unmarshal(encodedResult, &result); err != nil {
+		return Decision{}, fmt.Errorf("policy: unexpected rego result shape: %s", err)
+	}
+
+	return Decision{Allowed: result.Allow, Rule: result.Rule, Reason: result.Reason}, nil
+}
@@ -0,0 +1,105 @@
+// Package policy turns mountpoint.MountPointPattern into one flavor of
+// a broader pluggable policy engine for mount admission decisions: the
+// daemon's volume registration path evaluates a candidate MountPoint
+// against a configured Engine (native patterns, a Rego/OPA policy, or a
+// JSON/YAML rule list) before the mount is created or middleware is
+// applied to it.
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/volume/mountpoint"
+)
+
+// Action is a directive a matched policy rule attaches to its Decision,
+// beyond the plain allow/deny verdict.
+type Action string
+
+// Action constants. ApplyMiddlewarePrefix and RequireConsistencyPrefix
+// actions carry their parameter appended after the colon (e.g.
+// "apply-middleware:audit", "require-consistency:cached") rather than
+// having their own constant, since the parameter is open-ended.
+const (
+	ActionAllow           Action = "allow"
+	ActionDeny            Action = "deny"
+	ActionRequireReadOnly Action = "require-readonly"
+
+	ApplyMiddlewarePrefix    = "apply-middleware:"
+	RequireConsistencyPrefix = "require-consistency:"
+)
+
+// Decision is the outcome of evaluating a MountPoint against an Engine.
+type Decision struct {
+	// Allowed reports whether the mount point may proceed.
+	Allowed bool
+
+	// Rule names the rule responsible for this decision (a native rule
+	// name, a rule-list entry name, or a Rego policy's own identifier),
+	// for inclusion in a ForbiddenError and for the debug dry-run path.
+	Rule string
+
+	// Reason is a human-readable explanation of the decision, if the
+	// backend provided one.
+	Reason string
+
+	// Actions lists any additional directives the matched rule carries
+	// (apply-middleware:<name>, require-readonly,
+	// require-consistency:<mode>) for the caller to apply once the
+	// mount point itself is admitted.
+	Actions []Action
+}
+
+// Engine evaluates a candidate MountPoint against a loaded policy and
+// returns an admission Decision. The daemon's volume registration path
+// is written against this interface, not against any one backend, so
+// operators can swap native patterns for a Rego policy or a rule list
+// without changing call sites.
+type Engine interface {
+	Evaluate(ctx context.Context, mount *mountpoint.MountPoint) (Decision, error)
+}
+
+// ForbiddenError reports that a MountPoint was denied by a policy
+// Engine. It implements the same Forbidden() marker method convention
+// github.com/docker/docker/errdefs uses to classify errors by HTTP
+// status, so a caller that routes errors through errdefs.GetHTTPErrorStatusCode
+// sees this as a 403 once wired into the daemon's error stack; this
+// source tree doesn't vendor errdefs, so the marker method is defined
+// directly here instead.
+type ForbiddenError struct {
+	Rule   string
+	Reason string
+}
+
+func (e *ForbiddenError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("mount point forbidden by policy rule %q: %s", e.Rule, e.Reason)
+	}
+	return fmt.Sprintf("mount point forbidden by policy rule %q", e.Rule)
+}
+
+// Forbidden marks this as an errdefs-style forbidden error.
+func (e *ForbiddenError) Forbidden() {}
+
+// Evaluate runs mount through engine and converts a deny Decision into
+// a *ForbiddenError, the contract the daemon's volume registration path
+// expects: a nil error for allow, and a *ForbiddenError (carrying the
+// matched rule name) otherwise.
+func Evaluate(ctx context.Context, engine Engine, mount *mountpoint.MountPoint) (Decision, error) {
+	decision, err := engine.Evaluate(ctx, mount)
+	if err != nil {
+		return Decision{}, err
+	}
+	if !decision.Allowed {
+		return decision, &ForbiddenError{Rule: decision.Rule, Reason: decision.Reason}
+	}
+	return decision, nil
+}
+
+// DryRun evaluates mount against engine without converting a deny
+// Decision into an error, so a debug endpoint can report why a
+// candidate mount point would or wouldn't be admitted.
+func DryRun(ctx context.Context, engine Engine, mount *mountpoint.MountPoint) (Decision, error) {
+	return engine.Evaluate(ctx, mount)
+}
@@ -0,0 +1,200 @@
+package policy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/docker/volume/mountpoint"
+)
+
+func TestNativeEngineFirstMatchWins(t *testing.T) {
+	engine, err := NewNativeEngine([]NativeRule{
+		{
+			Name:    "deny-etc",
+			Pattern: mountpoint.MountPointPattern{Destination: []mountpoint.StringPattern{{PathPrefix: "/etc"}}},
+			Action:  ActionDeny,
+		},
+		{
+			Name:    "allow-all",
+			Pattern: mountpoint.MountPointPattern{},
+			Action:  ActionAllow,
+		},
+	})
+	require.Nil(t, err)
+
+	decision, err := engine.Evaluate(context.Background(), &mountpoint.MountPoint{Destination: "/etc/app"})
+	require.Nil(t, err)
+	require.Equal(t, false, decision.Allowed)
+	require.Equal(t, "deny-etc", decision.Rule)
+
+	decision, err = engine.Evaluate(context.Background(), &mountpoint.MountPoint{Destination: "/data"})
+	require.Nil(t, err)
+	require.Equal(t, true, decision.Allowed)
+	require.Equal(t, "allow-all", decision.Rule)
+}
+
+func TestNativeEngineNoMatchIsAllowed(t *testing.T) {
+	engine, err := NewNativeEngine([]NativeRule{
+		{
+			Name:    "deny-etc",
+			Pattern: mountpoint.MountPointPattern{Destination: []mountpoint.StringPattern{{PathPrefix: "/etc"}}},
+			Action:  ActionDeny,
+		},
+	})
+	require.Nil(t, err)
+
+	decision, err := engine.Evaluate(context.Background(), &mountpoint.MountPoint{Destination: "/data"})
+	require.Nil(t, err)
+	require.Equal(t, true, decision.Allowed)
+	require.Equal(t, "", decision.Rule)
+}
+
+func TestEvaluateConvertsDenyToForbiddenError(t *testing.T) {
+	engine, err := NewNativeEngine([]NativeRule{
+		{
+			Name:    "deny-etc",
+			Pattern: mountpoint.MountPointPattern{Destination: []mountpoint.StringPattern{{PathPrefix: "/etc"}}},
+			Action:  ActionDeny,
+		},
+	})
+	require.Nil(t, err)
+
+	_, err = Evaluate(context.Background(), engine, &mountpoint.MountPoint{Destination: "/etc/app"})
+	require.Error(t, err)
+	forbidden, ok := err.(*ForbiddenError)
+	require.True(t, ok)
+	require.Equal(t, "deny-etc", forbidden.Rule)
+
+	_, err = Evaluate(context.Background(), engine, &mountpoint.MountPoint{Destination: "/data"})
+	require.Nil(t, err)
+}
+
+func TestDryRunDoesNotError(t *testing.T) {
+	engine, err := NewNativeEngine([]NativeRule{
+		{
+			Name:    "deny-etc",
+			Pattern: mountpoint.MountPointPattern{Destination: []mountpoint.StringPattern{{PathPrefix: "/etc"}}},
+			Action:  ActionDeny,
+		},
+	})
+	require.Nil(t, err)
+
+	decision, err := DryRun(context.Background(), engine, &mountpoint.MountPoint{Destination: "/etc/app"})
+	require.Nil(t, err)
+	require.Equal(t, false, decision.Allowed)
+	require.Equal(t, "deny-etc", decision.Rule)
+}
+
+func TestRuleListEngineFromJSON(t *testing.T) {
+	doc, err := LoadRuleListJSON([]byte(`{
+		"rules": [
+			{
+				"name": "require-ro-secrets",
+				"pattern": {"Destination": [{"PathPrefix": "/secrets"}]},
+				"actions": ["allow", "require-readonly"]
+			},
+			{
+				"name": "deny-var-run",
+				"pattern": {"Destination": [{"PathPrefix": "/var/run"}]},
+				"actions": ["deny"]
+			}
+		]
+	}`))
+	require.Nil(t, err)
+
+	engine, err := NewRuleListEngine(doc)
+	require.Nil(t, err)
+
+	decision, err := engine.Evaluate(context.Background(), &mountpoint.MountPoint{Destination: "/secrets/db"})
+	require.Nil(t, err)
+	require.Equal(t, true, decision.Allowed)
+	require.Equal(t, "require-ro-secrets", decision.Rule)
+	require.Equal(t, []Action{ActionRequireReadOnly}, decision.Actions)
+
+	decision, err = engine.Evaluate(context.Background(), &mountpoint.MountPoint{Destination: "/var/run/docker.sock"})
+	require.Nil(t, err)
+	require.Equal(t, false, decision.Allowed)
+	require.Equal(t, "deny-var-run", decision.Rule)
+
+	decision, err = engine.Evaluate(context.Background(), &mountpoint.MountPoint{Destination: "/data"})
+	require.Nil(t, err)
+	require.Equal(t, true, decision.Allowed)
+	require.Equal(t, "", decision.Rule)
+}
+
+func TestRuleListEngineApplyMiddlewareAction(t *testing.T) {
+	doc, err := LoadRuleListJSON([]byte(`{
+		"rules": [
+			{
+				"name": "audit-volumes",
+				"pattern": {"Type": "volume"},
+				"actions": ["allow", "apply-middleware:audit"]
+			}
+		]
+	}`))
+	require.Nil(t, err)
+
+	engine, err := NewRuleListEngine(doc)
+	require.Nil(t, err)
+
+	decision, err := engine.Evaluate(context.Background(), &mountpoint.MountPoint{Type: mountpoint.TypeVolume})
+	require.Nil(t, err)
+	require.Equal(t, true, decision.Allowed)
+	require.Equal(t, []Action{Action("apply-middleware:audit")}, decision.Actions)
+}
+
+const testOPADenyEtcModule = `
+package docker.mounts
+
+decision = {"allow": false, "rule": "deny-etc", "reason": "etc is read-only"} {
+	startswith(input.Destination, "/etc")
+} else = {"allow": true, "rule": "", "reason": ""} {
+	true
+}
+`
+
+func TestOPAEngineEvaluatesRegoQueryAgainstMountPoint(t *testing.T) {
+	engine, err := NewOPAEngine(context.Background(), testOPADenyEtcModule, "data.docker.mounts.decision")
+	require.Nil(t, err)
+
+	decision, err := engine.Evaluate(context.Background(), &mountpoint.MountPoint{Destination: "/etc/app"})
+	require.Nil(t, err)
+	require.Equal(t, false, decision.Allowed)
+	require.Equal(t, "deny-etc", decision.Rule)
+
+	decision, err = engine.Evaluate(context.Background(), &mountpoint.MountPoint{Destination: "/data"})
+	require.Nil(t, err)
+	require.Equal(t, true, decision.Allowed)
+	require.Equal(t, "", decision.Rule)
+}
+
+func TestOPAEngineConvertsDenyToForbiddenError(t *testing.T) {
+	engine, err := NewOPAEngine(context.Background(), testOPADenyEtcModule, "data.docker.mounts.decision")
+	require.Nil(t, err)
+
+	_, err = Evaluate(context.Background(), engine, &mountpoint.MountPoint{Destination: "/etc/app"})
+	require.Error(t, err)
+	forbidden, ok := err.(*ForbiddenError)
+	require.True(t, ok)
+	require.Equal(t, "deny-etc", forbidden.Rule)
+
+	_, err = Evaluate(context.Background(), engine, &mountpoint.MountPoint{Destination: "/data"})
+	require.Nil(t, err)
+}
+
+func TestRuleListEngineRejectsUnrecognizedAction(t *testing.T) {
+	doc, err := LoadRuleListJSON([]byte(`{
+		"rules": [
+			{"name": "bogus", "pattern": {}, "actions": ["frobnicate"]}
+		]
+	}`))
+	require.Nil(t, err)
+
+	engine, err := NewRuleListEngine(doc)
+	require.Nil(t, err)
+
+	_, err = engine.Evaluate(context.Background(), &mountpoint.MountPoint{})
+	require.Error(t, err)
+}
@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/volume/mountpoint"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// RuleListDocument is the on-disk shape of a rule-list policy: a named,
+// ordered list of rules, each chaining a MountPointPattern to one or
+// more actions. The first matching rule decides the outcome; later
+// rules are not consulted.
+type RuleListDocument struct {
+	Rules []RuleListEntry `json:"rules" yaml:"rules"`
+}
+
+// RuleListEntry is a single named rule within a RuleListDocument.
+// Actions are raw strings, since "apply-middleware:<name>" and
+// "require-consistency:<mode>" carry a parameter inline.
+type RuleListEntry struct {
+	Name    string                       `json:"name" yaml:"name"`
+	Pattern mountpoint.MountPointPattern `json:"pattern" yaml:"pattern"`
+	Actions []string                     `json:"actions" yaml:"actions"`
+}
+
+// LoadRuleListJSON parses a JSON-encoded RuleListDocument.
+func LoadRuleListJSON(data []byte) (*RuleListDocument, error) {
+	var doc RuleListDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("policy: invalid rule list JSON: %s", err)
+	}
+	return &doc, nil
+}
+
+// LoadRuleListYAML parses a YAML-encoded RuleListDocument.
+func LoadRuleListYAML(data []byte) (*RuleListDocument, error) {
+	var doc RuleListDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("policy: invalid rule list YAML: %s", err)
+	}
+	return &doc, nil
+}
+
+// RuleListEngine evaluates a RuleListDocument's entries in order,
+// compiling each entry's pattern up front.
+type RuleListEngine struct {
+	entries []compiledRuleListEntry
+}
+
+type compiledRuleListEntry struct {
+	RuleListEntry
+	compiled *mountpoint.CompiledPattern
+}
+
+// NewRuleListEngine compiles doc's patterns up front.
+func NewRuleListEngine(doc *RuleListDocument) (*RuleListEngine, error) {
+	entries := make([]compiledRuleListEntry, len(doc.Rules))
+	for i, entry := range doc.Rules {
+		c, err := mountpoint.Compile(entry.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("policy: rule %q: %s", entry.Name, err)
+		}
+		entries[i] = compiledRuleListEntry{RuleListEntry: entry, compiled: c}
+	}
+	return &RuleListEngine{entries: entries}, nil
+}
+
+// Evaluate returns the first matching entry's Decision, translating its
+// Actions strings into the Decision shape: "deny" clears Allowed,
+// "allow" is a no-op (Allowed already defaults to true), and every
+// other recognized action is passed through verbatim for the caller to
+// apply. An unrecognized action is a configuration error.
+func (e *RuleListEngine) Evaluate(ctx context.Context, mount *mountpoint.MountPoint) (Decision, error) {
+	for _, entry := range e.entries {
+		if !entry.compiled.Matches(mount) {
+			continue
+		}
+
+		decision := Decision{Rule: entry.Name, Allowed: true}
+		for _, raw := range entry.Actions {
+			action := Action(raw)
+			switch {
+			case action == ActionDeny:
+				decision.Allowed = false
+			case action == ActionAllow:
+				// no-op: Allowed already defaults to true
+			case action == ActionRequireReadOnly:
+				decision.Actions = append(decision.Actions, action)
+			case strings.HasPrefix(raw, ApplyMiddlewarePrefix):
+				decision.Actions = append(decision.Actions, action)
+			case strings.HasPrefix(raw, RequireConsistencyPrefix):
+				decision.Actions = append(decision.Actions, action)
+			default:
+				return Decision{}, fmt.Errorf("policy: rule %q: unrecognized action %q", entry.Name, raw)
+			}
+		}
+		return decision, nil
+	}
+	return Decision{Allowed: true}, nil
+}
@@ -0,0 +1,153 @@
+// Package schema reflects over the mountpoint package's pattern types
+// (MountPointPattern, StringPattern, AppliedMiddlewareStackPattern,
+// StringMapPattern, and everything they reference) to produce a JSON
+// Schema (draft 2020-12) document describing the shape a user-authored
+// MountPointPattern document must take. External tools (dashboards,
+// admission controllers, docker compose linters) can validate documents
+// against this schema before submitting them to the daemon.
+package schema
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/volume/mountpoint"
+)
+
+// Generate produces the JSON Schema document for mountpoint.MountPointPattern.
+func Generate() (map[string]interface{}, error) {
+	g := &generator{defs: map[string]interface{}{}, seen: map[reflect.Type]bool{}}
+	root := g.typeSchema(reflect.TypeOf(mountpoint.MountPointPattern{}))
+
+	doc := map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id":     "https://raw.githubusercontent.com/dsheets/docker/main/volume/mounts/schema/mountpoint.schema.json",
+	}
+	for k, v := range root.(map[string]interface{}) {
+		doc[k] = v
+	}
+	doc["$defs"] = g.defs
+	return doc, nil
+}
+
+// generator walks a type graph rooted at MountPointPattern, registering
+// one $defs entry per distinct struct type it encounters and returning
+// $ref objects that point at them. seen guards self-referential types
+// (MountPointPattern.AnyOf/AllOf/OneOf/Not all reference MountPointPattern
+// itself) against infinite recursion.
+type generator struct {
+	defs map[string]interface{}
+	seen map[reflect.Type]bool
+}
+
+func (g *generator) typeSchema(t reflect.Type) interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.typeSchema(t.Elem())
+	case reflect.Slice:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": g.typeSchema(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": g.typeSchema(t.Elem()),
+		}
+	case reflect.Struct:
+		return g.structRef(t)
+	case reflect.String:
+		return g.stringSchema(t)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+}
+
+// stringSchema returns an enum schema for the mountpoint package's
+// named string types, and for the two github.com/docker/docker/api/types/mount
+// enums this tree doesn't vendor (their constants aren't available via
+// reflection, so the values are mirrored here by hand). Any other named
+// string type (e.g. AppliedMiddlewarePattern.Select, a free-form name)
+// gets a plain string schema.
+func (g *generator) stringSchema(t reflect.Type) interface{} {
+	switch t.Name() {
+	case "Type":
+		return map[string]interface{}{"type": "string", "enum": []string{"bind", "volume", "tmpfs", "secret", "npipe", "block"}}
+	case "Scope":
+		return map[string]interface{}{"type": "string", "enum": []string{"local", "global"}}
+	case "Quantifier":
+		return map[string]interface{}{"type": "string", "enum": []string{"", "zeroOrOne", "zeroOrMore", "oneOrMore"}}
+	case "Propagation":
+		return map[string]interface{}{"type": "string", "enum": []string{"rprivate", "private", "rshared", "shared", "rslave", "slave"}}
+	case "Consistency":
+		return map[string]interface{}{"type": "string", "enum": []string{"default", "consistent", "cached", "delegated"}}
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+}
+
+// structRef returns a $ref to t's $defs entry, building and registering
+// that entry the first time t is seen.
+func (g *generator) structRef(t reflect.Type) interface{} {
+	name := t.Name()
+	ref := map[string]interface{}{"$ref": "#/$defs/" + name}
+
+	if g.seen[t] {
+		return ref
+	}
+	g.seen[t] = true
+
+	properties := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		fieldName, omitempty := parseJSONTag(field.Tag.Get("json"))
+		if fieldName == "-" {
+			continue
+		}
+		if fieldName == "" {
+			fieldName = field.Name
+		}
+
+		properties[fieldName] = g.typeSchema(field.Type)
+		if !omitempty {
+			required = append(required, fieldName)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+
+	g.defs[name] = schema
+	return ref
+}
+
+// parseJSONTag splits a `json:"..."` tag into its field name override
+// (empty means use the Go field name) and whether it carries omitempty.
+func parseJSONTag(tag string) (name string, omitempty bool) {
+	if tag == "" {
+		return "", false
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty
+}
@@ -0,0 +1,74 @@
+package schema
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/docker/docker/volume/mountpoint"
+)
+
+// TestSchemaNoDrift regenerates the schema from the current mountpoint
+// types and compares it against the committed mountpoint.schema.json,
+// failing when the two diverge -- i.e. when a pattern type changed
+// without regenerating and committing the schema alongside it. The
+// comparison round-trips the generated schema through JSON first so
+// that []string/map[string]interface{} built directly by Generate
+// compare equal to the generic interface{} values json.Unmarshal
+// produces from the committed file.
+func TestSchemaNoDrift(t *testing.T) {
+	generated, err := Generate()
+	require.Nil(t, err)
+
+	generatedJSON, err := json.Marshal(generated)
+	require.Nil(t, err)
+	var generatedDoc map[string]interface{}
+	require.Nil(t, json.Unmarshal(generatedJSON, &generatedDoc))
+
+	committed, err := ioutil.ReadFile("mountpoint.schema.json")
+	require.Nil(t, err)
+	var committedDoc map[string]interface{}
+	require.Nil(t, json.Unmarshal(committed, &committedDoc))
+
+	require.Equal(t, committedDoc, generatedDoc, "mountpoint.schema.json is out of date -- regenerate it with hack/gen-mountpoint-schema")
+}
+
+// TestTypeEnumMatchesMountpointTypeConstants guards against the failure
+// mode TestSchemaNoDrift can't catch: generate.go's hand-maintained
+// "Type" enum and the committed schema going stale together when a new
+// mountpoint.Type constant is added, so the drift check between them
+// keeps passing even though both are wrong. This compares the generated
+// enum against the actual mountpoint.Type constants instead.
+func TestTypeEnumMatchesMountpointTypeConstants(t *testing.T) {
+	want := []string{
+		string(mountpoint.TypeBind),
+		string(mountpoint.TypeVolume),
+		string(mountpoint.TypeTmpfs),
+		string(mountpoint.TypeSecret),
+		string(mountpoint.TypeNamedPipe),
+		string(mountpoint.TypeBlock),
+	}
+	sort.Strings(want)
+
+	generated, err := Generate()
+	require.Nil(t, err)
+
+	defs, ok := generated["$defs"].(map[string]interface{})
+	require.True(t, ok, "$defs missing from generated schema")
+	mountPointPattern, ok := defs["MountPointPattern"].(map[string]interface{})
+	require.True(t, ok, "MountPointPattern missing from generated $defs")
+	properties, ok := mountPointPattern["properties"].(map[string]interface{})
+	require.True(t, ok, "MountPointPattern.properties missing from generated schema")
+	typeSchema, ok := properties["Type"].(map[string]interface{})
+	require.True(t, ok, "Type property missing from generated MountPointPattern schema")
+	enum, ok := typeSchema["enum"].([]string)
+	require.True(t, ok, "Type property has no string enum")
+
+	got := append([]string{}, enum...)
+	sort.Strings(got)
+
+	require.Equal(t, want, got, "generate.go's Type enum has drifted from the mountpoint.Type constants -- update stringSchema's \"Type\" case and regenerate mountpoint.schema.json")
+}